@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	batchConns  = 4   // 一次批量写入最多使用的链接数
+	batchWindow = 256 // 每个链接一次发送的最大命令数, 发送完再读取回复
+)
+
+// Document 批量写入的一个文档
+type Document struct {
+	Collection string
+	Bucket     string
+	Object     string
+	Text       string
+	Lang       string // 可选, ISO 639-3 语言代码或 LangNone
+}
+
+// PushResult 一个文档的写入结果, Err 为空表示成功
+type PushResult struct {
+	Document Document
+	Err      error
+}
+
+// PushBatch 批量写入文档, 文档会被分给多个链接, 每个链接上流水线发送 PUSH
+// 返回的结果和 docs 一一对应, err 为第一个失败文档的错误
+func (c *IngestClient) PushBatch(ctx context.Context, docs []Document) (results []PushResult, err error) {
+	results = make([]PushResult, len(docs))
+	for i, doc := range docs {
+		results[i].Document = doc
+	}
+	if len(docs) == 0 {
+		return results, nil
+	}
+
+	n := batchConns
+	if n > len(docs) {
+		n = len(docs)
+	}
+	size := (len(docs) + n - 1) / n
+
+	var wg sync.WaitGroup
+	for l := 0; l < len(docs); l += size {
+		r := l + size
+		if r > len(docs) {
+			r = len(docs)
+		}
+
+		wg.Add(1)
+		go func(results []PushResult) {
+			defer wg.Done()
+			c.pushGroup(ctx, results)
+		}(results[l:r])
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r.Err != nil {
+			return results, r.Err
+		}
+	}
+	return results, nil
+}
+
+// pushGroup 在一个池中的链接上写入一组文档, 结果写回 results
+func (c *IngestClient) pushGroup(ctx context.Context, results []PushResult) {
+	done := make([]bool, len(results))
+	err := c.pool.withConn(ctx, func(conn *Conn) error {
+		return conn.pushBatch(results, done)
+	})
+	// 没拿到链接或者链接中途出错, 没有收到全部回复的文档都算失败
+	if err != nil {
+		for i := range results {
+			if !done[i] && results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+	}
+}
+
+// batchLine 流水线中的一行命令以及它属于哪个文档
+type batchLine struct {
+	line string
+	doc  int
+}
+
+// pushBatch 在一个链接上流水线写入, 回复按发送顺序和命令对应
+// 服务端的 ERR 只记在对应的文档上, 链接出错时返回错误, 收到全部回复的文档记在 done 中
+func (c *Conn) pushBatch(results []PushResult, done []bool) error {
+	var lines []batchLine
+	for i, r := range results {
+		doc := r.Document
+		if err := validLang(doc.Lang); err != nil {
+			results[i].Err = err
+			done[i] = true
+			continue
+		}
+		for _, chunk := range c.splitText(doc.Text) {
+			line, err := buildPush(doc.Collection, doc.Bucket, doc.Object, chunk, doc.Lang)
+			if err != nil {
+				results[i].Err = err
+				done[i] = true
+				break
+			}
+			lines = append(lines, batchLine{line, i})
+		}
+	}
+
+	window := make([]string, 0, batchWindow)
+	for l := 0; l < len(lines); l += batchWindow {
+		r := l + batchWindow
+		if r > len(lines) {
+			r = len(lines)
+		}
+
+		window = window[:0]
+		for _, bl := range lines[l:r] {
+			window = append(window, bl.line)
+		}
+		// 每次写入窗口和读取每条回复之前都刷新截止时间, 大批量写入不会共用一次超时
+		if err := c.extendDeadline(); err != nil {
+			return err
+		}
+		if err := c.writeLines(window); err != nil {
+			return err
+		}
+
+		// sonic should sent OK for every line
+		for i, bl := range lines[l:r] {
+			if err := c.extendDeadline(); err != nil {
+				return err
+			}
+			_, err := c.read()
+			if err != nil && isBadConn(err) {
+				return err
+			}
+			if err != nil && results[bl.doc].Err == nil {
+				results[bl.doc].Err = err
+			}
+			// 文档的最后一个分片已经有回复
+			if l+i == len(lines)-1 || lines[l+i+1].doc != bl.doc {
+				done[bl.doc] = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushBatch(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	docs := []Document{
+		{Collection: "c", Bucket: "b", Object: "o1", Text: "hello world"},
+		{Collection: "c", Bucket: "b", Object: "bad id", Text: "hello"},
+		{Collection: "c", Bucket: "b", Object: "o2", Text: "hello", Lang: "xx"},
+		{Collection: "c", Bucket: "b", Object: "o3", Text: strings.Repeat("hello ", 10000)},
+		{Collection: "c", Bucket: "b", Object: "o4", Text: "world", Lang: "eng"},
+	}
+	results, err := c.PushBatch(ctx, docs)
+	if err == nil {
+		t.Fatal("PushBatch returned nil error with invalid documents")
+	}
+	if len(results) != len(docs) {
+		t.Fatalf("len(results) = %d, want %d", len(results), len(docs))
+	}
+
+	wantErr := []bool{false, true, true, false, false}
+	for i, r := range results {
+		if r.Document.Object != docs[i].Object {
+			t.Errorf("results[%d] is for %q, want %q", i, r.Document.Object, docs[i].Object)
+		}
+		if (r.Err != nil) != wantErr[i] {
+			t.Errorf("results[%d].Err = %v, want error %v", i, r.Err, wantErr[i])
+		}
+	}
+	if !errors.Is(results[1].Err, ErrInvalidIdent) {
+		t.Errorf("bad object id error = %v, want ErrInvalidIdent", results[1].Err)
+	}
+
+	if n, err := c.Count(ctx, "c", "b", ""); err != nil || n != 3 {
+		t.Fatalf("Count = %d, %v, want 3", n, err)
+	}
+}
+
+// 读超时限制的是每条回复, 而不是整批写入
+func TestPushBatchReadTimeoutPerReply(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s, WithReadTimeout(300*time.Millisecond))
+	ctx := testCtx(t)
+
+	docs := make([]Document, 1000)
+	for i := range docs {
+		docs[i] = Document{Collection: "c", Bucket: "b", Object: fmt.Sprint("o", i), Text: "hello"}
+	}
+
+	s.Conns("ingest").SetDelay(2 * time.Millisecond)
+	defer s.ResetFaults()
+	if _, err := c.PushBatch(ctx, docs); err != nil {
+		t.Fatalf("PushBatch: %v", err)
+	}
+}
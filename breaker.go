@@ -0,0 +1,165 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 熔断器打开, 不再尝试拨号, 直接失败
+// 返回的错误会带上最后一次拨号的错误, 需要用 errors.Is 判断
+var ErrCircuitOpen = errors.New("sonic: circuit breaker is open")
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	// BreakerClosed 正常拨号
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen 连续拨号失败, 冷却期间直接返回 ErrCircuitOpen
+	BreakerOpen
+
+	// BreakerHalfOpen 冷却结束, 允许少量拨号试探服务是否恢复
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerConfig 拨号熔断器的配置, 零值使用默认配置
+type BreakerConfig struct {
+	FailureThreshold int           // 连续失败多少次后打开, 默认等于 PoolSize
+	CoolDown         time.Duration // 打开后多久进入半开, 默认 1s
+	HalfOpenProbes   int           // 半开时同时允许的拨号数, 全部成功后关闭, 默认 1
+
+	// OnStateChange 状态变化时调用, 在持有锁的情况下调用, 不能在回调中使用连接池
+	OnStateChange func(from, to BreakerState)
+}
+
+// breaker 拨号熔断器
+type breaker struct {
+	cfg BreakerConfig
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   int // 半开时正在进行的拨号数
+	successes int // 半开时成功的拨号数
+	lastErr   error
+}
+
+func newBreaker(cfg BreakerConfig, poolSize int) *breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = poolSize
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = time.Second
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &breaker{cfg: cfg}
+}
+
+// allow 判断是否可以拨号, 不可以时返回 ErrCircuitOpen
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cfg.CoolDown {
+			return b.openErr()
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing >= b.cfg.HalfOpenProbes {
+			return b.openErr()
+		}
+		b.probing++
+	}
+	return nil
+}
+
+// success 拨号成功
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		b.failures = 0
+	case BreakerHalfOpen:
+		b.probing--
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// failure 拨号失败
+func (b *breaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastErr = err
+	switch b.state {
+	case BreakerClosed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		b.probing--
+		b.setState(BreakerOpen)
+	}
+}
+
+func (b *breaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *breaker) openErr() error {
+	if b.lastErr == nil {
+		return ErrCircuitOpen
+	}
+	return fmt.Errorf("%w: %v", ErrCircuitOpen, b.lastErr)
+}
+
+// setState 切换状态并重置计数, 需要持有锁
+func (b *breaker) setState(to BreakerState) {
+	from := b.state
+	if from == to {
+		return
+	}
+
+	b.state = to
+	b.failures = 0
+	b.successes = 0
+	if to == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+	if to != BreakerHalfOpen {
+		b.probing = 0
+	}
+
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreakerStates(t *testing.T) {
+	var transitions []BreakerState
+	b := newBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		CoolDown:         50 * time.Millisecond,
+		OnStateChange:    func(from, to BreakerState) { transitions = append(transitions, to) },
+	}, 10)
+	dialErr := errors.New("refused")
+
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow while closed: %v", err)
+		}
+		b.failure(dialErr)
+	}
+	err := b.allow()
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow after %d failures = %v, want ErrCircuitOpen", 2, err)
+	}
+
+	// 冷却后只放过一个试探, 试探失败重新打开
+	time.Sleep(60 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe after cool down: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second probe = %v, want ErrCircuitOpen", err)
+	}
+	b.failure(dialErr)
+	if s := b.current(); s != BreakerOpen {
+		t.Fatalf("state after failed probe = %s, want open", s)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe after cool down: %v", err)
+	}
+	b.success()
+
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+	}
+}
+
+func TestPoolBreaker(t *testing.T) {
+	s := newTestServer(t)
+
+	var mu sync.Mutex
+	var transitions []BreakerState
+	c := newTestIngest(t, s, WithBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		CoolDown:         100 * time.Millisecond,
+		OnStateChange: func(from, to BreakerState) {
+			mu.Lock()
+			transitions = append(transitions, to)
+			mu.Unlock()
+		},
+	}))
+	ctx := testCtx(t)
+
+	s.RefuseFor(300 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Count(ctx, "c", "", ""); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Count %d = %v, want a dial error", i, err)
+		}
+	}
+	if _, err := c.Count(ctx, "c", "", ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Count with open breaker = %v, want ErrCircuitOpen", err)
+	}
+	if st := c.pool.BreakerState(); st != BreakerOpen {
+		t.Fatalf("BreakerState = %s, want open", st)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		_, err := c.Count(ctx, "c", "", "")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Count still failing after the server came back: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if st := c.pool.BreakerState(); st != BreakerClosed {
+		t.Fatalf("BreakerState after recovery = %s, want closed", st)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(transitions) < 3 || transitions[0] != BreakerOpen ||
+		transitions[len(transitions)-2] != BreakerHalfOpen || transitions[len(transitions)-1] != BreakerClosed {
+		t.Fatalf("transitions = %v, want open ... half-open closed", transitions)
+	}
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBulkIndexerClosed 向已关闭的 BulkIndexer 添加文档
+var ErrBulkIndexerClosed = errors.New("sonic: bulk indexer is closed")
+
+// BulkIndexerConfig BulkIndexer 的配置, 零值使用默认配置
+type BulkIndexerConfig struct {
+	Workers          int           // 并发的 worker 数, 每个 worker 使用一个池中的链接, 默认 4
+	MaxInFlight      int           // 已添加但还没有结果的最大文档数, 达到后 Add 会阻塞, 默认 Workers*FlushSize*2
+	FlushSize        int           // 每个 worker 攒够多少个文档写入一次, 默认 64
+	FlushInterval    time.Duration // 没攒够时最长等待多久写入, 默认 1s
+	ProgressInterval time.Duration // OnProgress 的调用间隔, 默认 1s
+
+	OnProgress func(BulkStats)  // 定期回调进度, Close 时会再回调一次
+	OnFailure  func(PushResult) // 每个失败的文档回调一次
+}
+
+// BulkStats 批量写入的进度
+type BulkStats struct {
+	Indexed uint64        // 成功写入的文档数
+	Failed  uint64        // 失败的文档数
+	Bytes   uint64        // 成功写入的文本字节数
+	Elapsed time.Duration // 从创建开始经过的时间
+	Rate    float64       // 每秒成功写入的文档数
+}
+
+// DocumentIterator 文档迭代器, Next 返回 false 时结束, 之后通过 Err 获取错误
+type DocumentIterator interface {
+	Next() (Document, bool)
+	Err() error
+}
+
+// BulkIndexer 并发批量写入, 带背压和进度回调
+type BulkIndexer struct {
+	client *IngestClient
+	cfg    BulkIndexerConfig
+
+	queue chan Document
+	sem   chan struct{}
+
+	indexed uint64 // atomic
+	failed  uint64 // atomic
+	bytes   uint64 // atomic
+	started time.Time
+
+	mu      sync.RWMutex
+	closed  bool
+	workers sync.WaitGroup
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewBulkIndexer 创建并启动 BulkIndexer, 使用完后需要调用 Close
+func (c *IngestClient) NewBulkIndexer(cfg BulkIndexerConfig) *BulkIndexer {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.FlushSize <= 0 {
+		cfg.FlushSize = 64
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = cfg.Workers * cfg.FlushSize * 2
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.ProgressInterval <= 0 {
+		cfg.ProgressInterval = time.Second
+	}
+
+	b := &BulkIndexer{
+		client:  c,
+		cfg:     cfg,
+		queue:   make(chan Document, cfg.Workers),
+		sem:     make(chan struct{}, cfg.MaxInFlight),
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		b.workers.Add(1)
+		go b.worker()
+	}
+	go b.reporter()
+
+	return b
+}
+
+// Add 添加一个文档, 在途文档数达到 MaxInFlight 时阻塞直到有空位或 ctx 结束
+func (b *BulkIndexer) Add(ctx context.Context, doc Document) error {
+	select {
+	case b.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		<-b.sem
+		return ErrBulkIndexerClosed
+	}
+
+	select {
+	case b.queue <- doc:
+		return nil
+	case <-ctx.Done():
+		<-b.sem
+		return ctx.Err()
+	}
+}
+
+// AddFrom 添加 channel 中的所有文档, 直到 channel 关闭
+func (b *BulkIndexer) AddFrom(ctx context.Context, docs <-chan Document) error {
+	for {
+		select {
+		case doc, ok := <-docs:
+			if !ok {
+				return nil
+			}
+			if err := b.Add(ctx, doc); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// AddIter 添加迭代器中的所有文档
+func (b *BulkIndexer) AddIter(ctx context.Context, it DocumentIterator) error {
+	for {
+		doc, ok := it.Next()
+		if !ok {
+			return it.Err()
+		}
+		if err := b.Add(ctx, doc); err != nil {
+			return err
+		}
+	}
+}
+
+// Close 停止接收文档, 写入剩余的文档并等待所有 worker 退出
+// ctx 结束时不再等待, 剩余的文档仍会在后台继续写入
+func (b *BulkIndexer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBulkIndexerClosed
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	go func() {
+		b.workers.Wait()
+		close(b.stop)
+	}()
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 返回当前进度
+func (b *BulkIndexer) Stats() BulkStats {
+	st := BulkStats{
+		Indexed: atomic.LoadUint64(&b.indexed),
+		Failed:  atomic.LoadUint64(&b.failed),
+		Bytes:   atomic.LoadUint64(&b.bytes),
+		Elapsed: time.Since(b.started),
+	}
+	if secs := st.Elapsed.Seconds(); secs > 0 {
+		st.Rate = float64(st.Indexed) / secs
+	}
+	return st
+}
+
+// worker 攒够 FlushSize 个文档或者超过 FlushInterval 就写入一次
+func (b *BulkIndexer) worker() {
+	defer b.workers.Done()
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	docs := make([]Document, 0, b.cfg.FlushSize)
+	for {
+		select {
+		case doc, ok := <-b.queue:
+			if !ok {
+				b.flush(docs)
+				return
+			}
+			docs = append(docs, doc)
+			if len(docs) >= b.cfg.FlushSize {
+				b.flush(docs)
+				docs = docs[:0]
+			}
+		case <-ticker.C:
+			b.flush(docs)
+			docs = docs[:0]
+		}
+	}
+}
+
+func (b *BulkIndexer) flush(docs []Document) {
+	if len(docs) == 0 {
+		return
+	}
+
+	results := make([]PushResult, len(docs))
+	for i, doc := range docs {
+		results[i].Document = doc
+	}
+
+	b.client.pushGroup(context.Background(), results)
+
+	for i := range results {
+		if results[i].Err != nil {
+			atomic.AddUint64(&b.failed, 1)
+			if b.cfg.OnFailure != nil {
+				b.cfg.OnFailure(results[i])
+			}
+		} else {
+			atomic.AddUint64(&b.indexed, 1)
+			atomic.AddUint64(&b.bytes, uint64(len(results[i].Document.Text)))
+		}
+		<-b.sem
+	}
+}
+
+// reporter 定期回调进度, 所有 worker 退出后回调最后一次
+func (b *BulkIndexer) reporter() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.cfg.ProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if b.cfg.OnProgress != nil {
+				b.cfg.OnProgress(b.Stats())
+			}
+		case <-b.stop:
+			if b.cfg.OnProgress != nil {
+				b.cfg.OnProgress(b.Stats())
+			}
+			return
+		}
+	}
+}
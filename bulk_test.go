@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkIndexer(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	var mu sync.Mutex
+	var failures []PushResult
+	var last BulkStats
+	b := c.NewBulkIndexer(BulkIndexerConfig{
+		Workers:       3,
+		FlushSize:     16,
+		FlushInterval: 20 * time.Millisecond,
+		OnFailure: func(r PushResult) {
+			mu.Lock()
+			failures = append(failures, r)
+			mu.Unlock()
+		},
+		OnProgress: func(st BulkStats) {
+			mu.Lock()
+			last = st
+			mu.Unlock()
+		},
+	})
+
+	docs := make(chan Document)
+	go func() {
+		defer close(docs)
+		for i := 0; i < 200; i++ {
+			docs <- Document{Collection: "c", Bucket: "b", Object: fmt.Sprint("o", i), Text: "hello"}
+		}
+		docs <- Document{Collection: "c", Bucket: "b", Object: "bad id", Text: "hello"}
+	}()
+	if err := b.AddFrom(ctx, docs); err != nil {
+		t.Fatalf("AddFrom: %v", err)
+	}
+	if err := b.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := b.Add(ctx, Document{}); !errors.Is(err, ErrBulkIndexerClosed) {
+		t.Fatalf("Add after Close = %v, want ErrBulkIndexerClosed", err)
+	}
+
+	st := b.Stats()
+	if st.Indexed != 200 || st.Failed != 1 || st.Bytes != 200*5 {
+		t.Fatalf("Stats = %+v, want 200 indexed, 1 failed", st)
+	}
+	mu.Lock()
+	if len(failures) != 1 || !errors.Is(failures[0].Err, ErrInvalidIdent) {
+		t.Errorf("failures = %v, want one ErrInvalidIdent", failures)
+	}
+	if last.Indexed != 200 {
+		t.Errorf("final progress = %+v, want 200 indexed", last)
+	}
+	mu.Unlock()
+
+	if n, err := c.Count(ctx, "c", "b", ""); err != nil || n != 200 {
+		t.Fatalf("Count = %d, %v, want 200", n, err)
+	}
+}
+
+func TestBulkIndexerBackpressure(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	b := c.NewBulkIndexer(BulkIndexerConfig{Workers: 1, FlushSize: 1, MaxInFlight: 2})
+
+	slow := s.Conns("ingest").SetDelay(300 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := b.Add(ctx, Document{Collection: "c", Bucket: "b", Object: fmt.Sprint("o", i), Text: "hello"}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	// 在途文档数已经达到 MaxInFlight, Add 阻塞直到 ctx 结束
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := b.Add(short, Document{Collection: "c", Bucket: "b", Object: "o2", Text: "hello"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Add over MaxInFlight = %v, want context.DeadlineExceeded", err)
+	}
+
+	slow.SetDelay(0)
+	if err := b.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if st := b.Stats(); st.Indexed != 2 {
+		t.Fatalf("Stats = %+v, want 2 indexed", st)
+	}
+}
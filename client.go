@@ -1 +1,210 @@
 package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultPort sonic 默认端口
+const DefaultPort = 1491
+
+// Client 持有 search, ingest, control 三个通道的客户端, 每个通道有自己的连接池
+type Client struct {
+	search  *SearchClient
+	ingest  *IngestClient
+	control *ControlClient
+}
+
+// New 根据 DSN 创建客户端, 例如
+// sonic://:password@host:1491?pool_size=40&min_idle=10&idle_timeout=30s
+// ctx 用于建立第一个链接, 检查地址和密码是否正确, opts 会覆盖 DSN 中的参数
+// 连接池大小只作用于 search 和 ingest, control 通道和 NewControlClient 一样使用小连接池
+func New(ctx context.Context, dsn string, opts ...Option) (*Client, error) {
+	endpoint, password, opt, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	opt = applyOptions(opt, opts)
+	if err = opt.validate(); err != nil {
+		return nil, err
+	}
+
+	c := &Client{}
+	if c.search, err = newSearchClient(endpoint, password, opt); err != nil {
+		return nil, err
+	}
+	if c.ingest, err = newIngestClient(endpoint, password, opt); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	if c.control, err = newControlClient(endpoint, password, controlOptions(opt)); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	if _, err = c.search.Handshake(ctx); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// controlOptions control 通道使用自己的连接池大小, 读超时不小于 NewControlClient 的默认值
+func controlOptions(opt Options) Options {
+	copt := controlDefaults(opt)
+	if opt.ReadTimeout > copt.ReadTimeout {
+		copt.ReadTimeout = opt.ReadTimeout
+	}
+	return copt
+}
+
+// Search ...
+func (c *Client) Search() *SearchClient {
+	return c.search
+}
+
+// Ingest ...
+func (c *Client) Ingest() *IngestClient {
+	return c.ingest
+}
+
+// Control ...
+func (c *Client) Control() *ControlClient {
+	return c.control
+}
+
+// Close 关闭所有通道的连接池, New 中途失败时只关闭已经创建的
+func (c *Client) Close() error {
+	var closers []func() error
+	if c.search != nil {
+		closers = append(closers, c.search.Close)
+	}
+	if c.ingest != nil {
+		closers = append(closers, c.ingest.Close)
+	}
+	if c.control != nil {
+		closers = append(closers, c.control.Close)
+	}
+
+	var firstErr error
+	for _, closer := range closers {
+		if err := closer(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// parseDSN 解析 DSN, 没有指定的参数使用默认值
+func parseDSN(dsn string) (endpoint, password string, opt Options, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", opt, fmt.Errorf("sonic: invalid dsn: %v", err)
+	}
+	if u.Scheme != "sonic" {
+		return "", "", opt, fmt.Errorf("sonic: invalid dsn scheme: %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", "", opt, fmt.Errorf("sonic: dsn has no host")
+	}
+
+	port := DefaultPort
+	if u.Port() != "" {
+		port, err = strconv.Atoi(u.Port())
+		if err != nil {
+			return "", "", opt, fmt.Errorf("sonic: invalid dsn port: %q", u.Port())
+		}
+	}
+	endpoint = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+
+	if u.User != nil {
+		password, _ = u.User.Password()
+	}
+
+	opt = defaultOptions()
+	ints := map[string]*int{
+		"pool_size": &opt.PoolSize,
+		"min_idle":  &opt.MinIdleConns,
+	}
+	durations := map[string]*time.Duration{
+		"max_conn_age":         &opt.MaxConnAge,
+		"pool_timeout":         &opt.PoolTimeout,
+		"idle_timeout":         &opt.IdleTimeout,
+		"idle_check_frequency": &opt.IdleCheckFrequency,
+		"read_timeout":         &opt.ReadTimeout,
+		"write_timeout":        &opt.WriteTimeout,
+	}
+
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		if p, ok := ints[key]; ok {
+			*p, err = strconv.Atoi(value)
+			if err != nil {
+				return "", "", opt, fmt.Errorf("sonic: invalid dsn parameter %s: %q", key, value)
+			}
+			continue
+		}
+		if p, ok := durations[key]; ok {
+			*p, err = time.ParseDuration(value)
+			if err != nil {
+				return "", "", opt, fmt.Errorf("sonic: invalid dsn parameter %s: %q", key, value)
+			}
+			continue
+		}
+		return "", "", opt, fmt.Errorf("sonic: unknown dsn parameter %s", key)
+	}
+	_, opt.minIdleSet = u.Query()["min_idle"]
+
+	return endpoint, password, opt, nil
+}
+
+// defaultOptions 默认的连接池配置
+func defaultOptions() Options {
+	return Options{
+		ReadTimeout:  time.Second * 3,
+		WriteTimeout: time.Second * 3,
+
+		PoolSize:           40,
+		MinIdleConns:       10,
+		MaxConnAge:         time.Minute,
+		PoolTimeout:        time.Second * 2,
+		IdleTimeout:        time.Second * 30,
+		IdleCheckFrequency: time.Second * 2,
+	}
+}
+
+// newPool 检查配置并创建指定通道的连接池
+func newPool(endpoint, password string, ch Channel, opt Options) (*ConnPool, error) {
+	if err := opt.validate(); err != nil {
+		return nil, err
+	}
+	opt = connectOptions(endpoint, password, ch, opt)
+	return NewConnPool(&opt), nil
+}
+
+// connectOptions 设置建立指定通道链接的 Connector, 没有设置 Dialer 时使用 tcp 拨号
+func connectOptions(endpoint, password string, ch Channel, opt Options) Options {
+	if opt.Dialer == nil {
+		opt.Dialer = func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", endpoint)
+		}
+	}
+	timeout := opt.ReadTimeout
+	opt.Connector = func(ctx context.Context, netConn net.Conn) (*Conn, error) {
+		return newConnContext(ctx, netConn, ch, password, timeout)
+	}
+	return opt
+}
+
+// joinEndpoint endpoint 没有端口时加上 port
+func joinEndpoint(endpoint string, port int) string {
+	if _, _, err := net.SplitHostPort(endpoint); err == nil || port == 0 {
+		return endpoint
+	}
+	return net.JoinHostPort(endpoint, strconv.Itoa(port))
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	endpoint, password, opt, err := parseDSN("sonic://:pass@example.com?pool_size=8&min_idle=2&read_timeout=5s")
+	if err != nil {
+		t.Fatalf("parseDSN: %v", err)
+	}
+	if endpoint != "example.com:1491" || password != "pass" {
+		t.Fatalf("parseDSN = %q, %q, want example.com:1491, pass", endpoint, password)
+	}
+	if opt.PoolSize != 8 || opt.MinIdleConns != 2 || opt.ReadTimeout != 5*time.Second {
+		t.Fatalf("parseDSN options = %+v", opt)
+	}
+	if opt.WriteTimeout != defaultOptions().WriteTimeout {
+		t.Fatalf("WriteTimeout = %s, want the default", opt.WriteTimeout)
+	}
+
+	for _, dsn := range []string{
+		"http://localhost:1491",
+		"sonic://:1491",
+		"sonic://localhost:port",
+		"sonic://localhost?pool_size=x",
+		"sonic://localhost?read_timeout=3",
+		"sonic://localhost?unknown=1",
+	} {
+		if _, _, _, err := parseDSN(dsn); err == nil {
+			t.Errorf("parseDSN(%q) returned nil error", dsn)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	s := newTestServer(t)
+	ctx := testCtx(t)
+
+	c, err := New(ctx, s.DSN()+"?pool_size=20&min_idle=0", quiet)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Ingest().Push(ctx, "c", "b", "o", "hello"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if got, err := c.Search().Query(ctx, "c", "b", "hello", 10, 0); err != nil || len(got) != 1 {
+		t.Fatalf("Query = %v, %v, want [o]", got, err)
+	}
+	if _, err := c.Control().Info(ctx); err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+
+	// 连接池大小只作用于 search 和 ingest, control 使用自己的默认值
+	if n := c.ingest.pool.opt.PoolSize; n != 20 {
+		t.Errorf("ingest PoolSize = %d, want 20", n)
+	}
+	if n := c.control.pool.opt.PoolSize; n != 4 {
+		t.Errorf("control PoolSize = %d, want 4", n)
+	}
+	if d := c.control.pool.opt.ReadTimeout; d != 10*time.Second {
+		t.Errorf("control ReadTimeout = %s, want 10s", d)
+	}
+
+	if _, err := New(ctx, "sonic://:wrong@"+s.Addr(), quiet); err == nil {
+		t.Fatal("New with a wrong password returned nil error")
+	}
+}
+
+func TestClientClosePartial(t *testing.T) {
+	s := newTestServer(t)
+	search, err := NewSearchClient(s.Addr(), "secret", WithMinIdle(0), quiet)
+	if err != nil {
+		t.Fatalf("NewSearchClient: %v", err)
+	}
+
+	// New 在创建 ingest 或 control 时失败, 只关闭已经创建的 search
+	c := &Client{search: search}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := search.Query(testCtx(t), "c", "b", "hello", 10, 0); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Query after Close = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// Command 构造一行 sonic 命令, 检查标识符并转义引号中的文本
+// 第一个错误会被记录下来, 由 Build 返回
+type Command struct {
+	buf bytes.Buffer
+	err error
+}
+
+// NewCommand ...
+func NewCommand(name string) *Command {
+	c := &Command{}
+	c.buf.WriteString(name)
+	return c
+}
+
+// Ident 添加 collection, bucket, object 这样的标识符, 不能为空, 不能包含空白、控制字符和引号
+func (c *Command) Ident(v string) *Command {
+	if c.err != nil {
+		return c
+	}
+	if err := validIdent(v); err != nil {
+		c.err = err
+		return c
+	}
+	c.buf.WriteString(" ")
+	c.buf.WriteString(v)
+	return c
+}
+
+// Text 添加引号中的文本, 反斜杠、换行和引号会被转义
+func (c *Command) Text(v string) *Command {
+	if c.err != nil {
+		return c
+	}
+	c.buf.WriteString(" \"")
+	c.buf.WriteString(patternReplace(v))
+	c.buf.WriteString("\"")
+	return c
+}
+
+// Param 添加 KEY(value) 形式的参数
+func (c *Command) Param(key, value string) *Command {
+	if c.err != nil {
+		return c
+	}
+	if err := validIdent(value); err != nil {
+		c.err = err
+		return c
+	}
+	c.buf.WriteString(" ")
+	c.buf.WriteString(key)
+	c.buf.WriteString("(")
+	c.buf.WriteString(value)
+	c.buf.WriteString(")")
+	return c
+}
+
+// IntParam 添加整数参数, 例如 LIMIT(10)
+func (c *Command) IntParam(key string, n int) *Command {
+	if c.err == nil && n < 0 {
+		c.err = fmt.Errorf("%w: %s must not be negative: %d", ErrInvalidArgument, key, n)
+		return c
+	}
+	return c.Param(key, strconv.Itoa(n))
+}
+
+// Build 返回构造好的命令, 不包含结尾的 \r\n
+func (c *Command) Build() (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return c.buf.String(), nil
+}
+
+// validIdent 标识符不能为空, 不能包含空白、控制字符和引号
+func validIdent(v string) error {
+	if v == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidIdent)
+	}
+	for _, r := range v {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == '"' {
+			return fmt.Errorf("%w: %q", ErrInvalidIdent, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		cmd     *Command
+		want    string
+		wantErr error
+	}{
+		{NewCommand("PUSH").Ident("c").Ident("b").Ident("o").Text("hello"), `PUSH c b o "hello"`, nil},
+		{NewCommand("PUSH").Ident("c").Ident("b").Ident("o").Text("a \"b\"\nc \\ d"), `PUSH c b o "a \"b\"\nc \\ d"`, nil},
+		{NewCommand("QUERY").Ident("c").Ident("b").Text("x").IntParam("LIMIT", 5).IntParam("OFFSET", 0), `QUERY c b "x" LIMIT(5) OFFSET(0)`, nil},
+		{NewCommand("QUERY").Ident("c").Ident("b").Text("x").IntParam("LIMIT", -1), "", ErrInvalidArgument},
+		{NewCommand("FLUSHB").Ident("c").Ident(""), "", ErrInvalidIdent},
+		{NewCommand("FLUSHB").Ident("c").Ident("b c"), "", ErrInvalidIdent},
+		{NewCommand("FLUSHB").Ident("c").Ident("b\tc"), "", ErrInvalidIdent},
+		{NewCommand("FLUSHB").Ident("c").Ident("b\"c"), "", ErrInvalidIdent},
+		{NewCommand("FLUSHB").Ident("c").Ident("b\x00"), "", ErrInvalidIdent},
+		{NewCommand("PUSH").Ident("c").Ident("b").Ident("o").Text("x").Param("LANG", "e n"), "", ErrInvalidIdent},
+		// 第一个错误之后的调用不再生效
+		{NewCommand("FLUSHB").Ident("b c").IntParam("LIMIT", -1), "", ErrInvalidIdent},
+	}
+	for _, tt := range tests {
+		got, err := tt.cmd.Build()
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Build = %q, %v, want %v", got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Build = %q, %v, want %q", got, err, tt.want)
+		}
+	}
+}
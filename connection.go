@@ -3,6 +3,7 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -47,7 +48,13 @@ type Conn struct {
 	Reader      *bufio.Reader
 	netConn     net.Conn
 	cmdMaxBytes int
+	handshake   Handshake
 	closed      bool
+
+	// setDeadline 时的 ctx 和读写超时, extendDeadline 据此刷新截止时间
+	ctx          context.Context
+	readTimeout  time.Duration
+	writeTimeout time.Duration
 }
 
 // GetUsedAt ...
@@ -83,165 +90,225 @@ func NewConn(netConn net.Conn, ch Channel, password string) (conn *Conn, err err
 
 	conn.setUsedAt(time.Now())
 
-	err = conn.write(fmt.Sprintf("START %s %s", ch, password))
+	start, err := NewCommand("START").Ident(string(ch)).Ident(password).Build()
+	if err != nil {
+		return nil, err
+	}
+	err = conn.write(start)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = conn.read()     // CONNECTED
-	line, err := conn.read() // STARTED
+	line, err := conn.read() // CONNECTED <sonic-server v1.x.x>
+	if err != nil {
+		return nil, err
+	}
+	version, err := parseConnected(line)
 	if err != nil {
 		return nil, err
 	}
 
-	ss := strings.FieldsFunc(line, func(r rune) bool {
-		if unicode.IsSpace(r) || r == '(' || r == ')' {
-			return true
-		}
-		return false
-	})
-	bufferSize, err := strconv.Atoi(ss[len(ss)-1])
+	line, err = conn.read() // STARTED search protocol(1) buffer(20000)
+	if err != nil {
+		return nil, err
+	}
+	conn.handshake, err = parseStarted(line)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to parse STARTED response: %s", line)
+		return nil, err
 	}
-	conn.cmdMaxBytes = bufferSize
+	conn.handshake.ServerVersion = version
+	conn.cmdMaxBytes = conn.handshake.BufferSize
 
 	return conn, nil
 }
 
-// Read read line from conn
-func (cn *Conn) Read() (string, error) {
-	if cn.closed {
-		return "", ErrClosed
+// newConnContext 在 ctx 和 timeout 中较早的截止时间内完成 START 握手, 完成后清除截止时间
+// 服务端接受链接后迟迟不回复时, 握手不会一直阻塞
+func newConnContext(ctx context.Context, netConn net.Conn, ch Channel, password string, timeout time.Duration) (*Conn, error) {
+	if err := netConn.SetDeadline(deadline(ctx, time.Now(), timeout)); err != nil {
+		return nil, err
 	}
-	buffer := bytes.Buffer{}
-	for {
-		line, isPrefix, err := cn.Reader.ReadLine()
-		buffer.Write(line)
-		if err != nil {
-			if err == io.EOF {
-				cn.Close()
-			}
-			return "", err
+	cn, err := NewConn(netConn, ch, password)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
-		if !isPrefix {
-			break
+		// 截止时间到了但 ctx 的计时器可能还没有触发
+		if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+			return nil, context.DeadlineExceeded
 		}
+		return nil, err
 	}
-
-	str := buffer.String()
-	if strings.HasPrefix(str, "ERR ") {
-		return "", errors.New(str[4:])
+	if err = netConn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
 	}
-
-	return str, nil
+	return cn, nil
 }
 
-// Write write with end of "\r\n"
-func (cn *Conn) Write(str string) error {
-	if cn.closed {
-		return ErrClosed
-	}
+// Handshake 建立链接时服务端返回的信息
+type Handshake struct {
+	ServerVersion string // CONNECTED 中的版本, 如 sonic-server v1.4.9
+	Protocol      int    // 协议版本
+	BufferSize    int    // 单条命令的最大字节数
+}
 
-	buf := bytes.Buffer{}
-	buf.WriteString(str)
-	buf.WriteString("\r\n")
+// Handshake 返回链接的握手信息
+func (cn *Conn) Handshake() Handshake {
+	return cn.handshake
+}
 
-	_, err := cn.netConn.Write(buf.Bytes())
-	return err
+// parseConnected 解析 CONNECTED <sonic-server v1.4.9>
+func parseConnected(line string) (string, error) {
+	if !strings.HasPrefix(line, "CONNECTED") {
+		return "", fmt.Errorf("%w: unable to parse CONNECTED response: %s", ErrProtocol, line)
+	}
+	version := strings.TrimSpace(line[len("CONNECTED"):])
+	version = strings.TrimSuffix(strings.TrimPrefix(version, "<"), ">")
+	return version, nil
 }
 
-// ---------------------finished-----------------
-// --------------------unfinished----------------
+// parseStarted 解析 STARTED search protocol(1) buffer(20000)
+func parseStarted(line string) (hs Handshake, err error) {
+	if !strings.HasPrefix(line, "STARTED ") {
+		return hs, fmt.Errorf("%w: unable to parse STARTED response: %s", ErrProtocol, line)
+	}
 
-type searchClient struct {
-	*Conn
+	fields := parseFields(line[8:])
+	hs.Protocol, err = strconv.Atoi(fields["protocol"])
+	if err != nil {
+		return hs, fmt.Errorf("%w: unable to parse STARTED response: %s", ErrProtocol, line)
+	}
+	hs.BufferSize, err = strconv.Atoi(fields["buffer"])
+	if err != nil || hs.BufferSize <= 0 {
+		return hs, fmt.Errorf("%w: unable to parse STARTED response: %s", ErrProtocol, line)
+	}
+	return hs, nil
 }
 
-type ingestClient struct {
-	*Conn
-}
+// setDeadline 根据 ctx 和读写超时设置底层链接的截止时间, 都没有时清除截止时间
+func (cn *Conn) setDeadline(ctx context.Context, readTimeout, writeTimeout time.Duration) error {
+	cn.ctx, cn.readTimeout, cn.writeTimeout = ctx, readTimeout, writeTimeout
 
-type controlClient struct {
-	*Conn
+	now := time.Now()
+	err := cn.netConn.SetReadDeadline(deadline(ctx, now, readTimeout))
+	if err != nil {
+		return err
+	}
+	return cn.netConn.SetWriteDeadline(deadline(ctx, now, writeTimeout))
 }
 
-func (c *Conn) search(password string) (*searchClient, error) {
-	err := c.write(fmt.Sprintf("START %s %s", Search, password))
-	if err != nil {
-		return nil, err
+// extendDeadline 按 setDeadline 时的 ctx 和读写超时重新计算截止时间
+// 一次调用中有多轮读写时, 每一轮之前调用, 读写超时限制的是每一轮而不是整个调用
+func (cn *Conn) extendDeadline() error {
+	if cn.ctx == nil {
+		return nil
 	}
-	_, err = c.read()
-	_, err = c.read()
-	if err != nil {
-		return nil, err
+	if err := cn.ctx.Err(); err != nil {
+		return err
+	}
+	if err := cn.setDeadline(cn.ctx, cn.readTimeout, cn.writeTimeout); err != nil {
+		return err
 	}
-	return &searchClient{c}, nil
+	// ctx 可能刚好在刷新之前结束, withConn 设置的立即超时被覆盖了, 这里重新设置
+	if err := cn.ctx.Err(); err != nil {
+		_ = cn.netConn.SetDeadline(time.Now())
+		return err
+	}
+	return nil
 }
 
-func (c *Conn) ingest(password string) (*ingestClient, error) {
-	err := c.write(fmt.Sprintf("START %s %s", Ingest, password))
-	if err != nil {
-		return nil, err
+// deadline 取 ctx 截止时间和 now+timeout 中较早的一个
+func deadline(ctx context.Context, now time.Time, timeout time.Duration) time.Time {
+	var tm time.Time
+	if timeout > 0 {
+		tm = now.Add(timeout)
 	}
-	_, err = c.read()
-	_, err = c.read()
-	if err != nil {
-		return nil, err
+	if d, ok := ctx.Deadline(); ok && (tm.IsZero() || d.Before(tm)) {
+		tm = d
 	}
-	return &ingestClient{c}, nil
+	return tm
 }
 
-func (c *Conn) control(password string) (*controlClient, error) {
-	err := c.write(fmt.Sprintf("START %s %s", Control, password))
-	if err != nil {
-		return nil, err
+// parseFields 解析形如 key(value) 的字段, 不带括号的字段会被忽略
+func parseFields(line string) map[string]string {
+	fields := make(map[string]string)
+	for _, token := range strings.Fields(line) {
+		l := strings.IndexByte(token, '(')
+		if l <= 0 || !strings.HasSuffix(token, ")") {
+			continue
+		}
+		fields[token[:l]] = token[l+1 : len(token)-1]
+	}
+	return fields
+}
+
+// parseResult 解析 RESULT NUMBER
+func parseResult(line string) (int, error) {
+	if !strings.HasPrefix(line, "RESULT ") {
+		return 0, fmt.Errorf("%w: unable to parse RESULT response: %s", ErrProtocol, line)
 	}
-	_, err = c.read()
-	_, err = c.read()
+	n, err := strconv.Atoi(line[7:])
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("%w: unable to parse RESULT response: %s", ErrProtocol, line)
 	}
-	return &controlClient{c}, nil
+	return n, nil
 }
 
-func newConnection(endpoint, password string, channel Channel) (*Conn, error) {
-	c := &Conn{}
-	c.Close()
-	conn, err := net.Dial("tcp", endpoint)
-	if err != nil {
-		return nil, err
+// Read read line from conn
+func (cn *Conn) Read() (string, error) {
+	return cn.read()
+}
+
+// Write write with end of "\r\n"
+func (cn *Conn) Write(str string) error {
+	if cn.closed {
+		return ErrClosed
 	}
 
-	c.closed = false
-	c.netConn = conn
-	c.Reader = bufio.NewReader(c.netConn)
+	buf := bytes.Buffer{}
+	buf.WriteString(str)
+	buf.WriteString("\r\n")
 
-	return c, nil
+	_, err := cn.netConn.Write(buf.Bytes())
+	return err
 }
 
 func (c *Conn) read() (string, error) {
 	if c.closed {
 		return "", ErrClosed
 	}
+	str, err := c.readLine()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.Close()
+	}
+	return str, err
+}
+
+// readLine 读取一行, 出错时不会关闭链接, 多路复用的读协程直接使用
+func (c *Conn) readLine() (string, error) {
 	buffer := bytes.Buffer{}
 	for {
-		line, isPrefix, err := c.Reader.ReadLine()
+		line, err := c.Reader.ReadSlice('\n')
 		buffer.Write(line)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
 		if err != nil {
-			if err == io.EOF {
-				c.Close()
+			// 链接在一行中途断开, 已读到的半行不能当作完整的回复
+			if err == io.EOF && buffer.Len() > 0 {
+				err = io.ErrUnexpectedEOF
 			}
 			return "", err
 		}
-		if !isPrefix {
-			break
-		}
+		break
 	}
 
-	str := buffer.String()
+	str := strings.TrimRight(buffer.String(), "\r\n")
 	if strings.HasPrefix(str, "ERR ") {
-		return "", errors.New(str[4:])
+		return "", newServerError(str[4:])
+	}
+	if strings.HasPrefix(str, "ENDED ") {
+		return "", newEndedError(str[6:])
 	}
 
 	return str, nil
@@ -255,6 +322,31 @@ func (c Conn) write(str string) error {
 	return err
 }
 
+// roundTrip 发送一条命令并读取一行回复
+func (c *Conn) roundTrip(cmd string) (string, error) {
+	if err := c.extendDeadline(); err != nil {
+		return "", err
+	}
+	if err := c.write(cmd); err != nil {
+		return "", err
+	}
+	return c.read()
+}
+
+// writeLines 一次写入多行, 用于流水线发送命令
+func (c *Conn) writeLines(lines []string) error {
+	if c.closed {
+		return ErrClosed
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteString("\r\n")
+	}
+	_, err := c.netConn.Write(buf.Bytes())
+	return err
+}
+
 func (c *Conn) Close() (err error) {
 	if c.netConn != nil {
 		err = c.netConn.Close()
@@ -272,42 +364,49 @@ func (c *Conn) Close() (err error) {
 // taking O(n) time (both ways!),
 // whereas slicing a string simply returns a new string header backed by the same array as the original
 // (taking constant time).
+// 切分的是转义前的文本, 按转义后的长度计算, 保证转义序列不会被切开
+// 尽量在空白处切分, 避免把一个词切成两半
 func (c *Conn) splitText(longString string) []string {
 	var splits []string
 
-	var l, r int
-	for l, r = 0, c.cmdMaxBytes/2; r < len(longString); l, r = r, r+c.cmdMaxBytes/2 {
-		for !utf8.RuneStart(longString[r]) {
-			r--
+	limit := c.cmdMaxBytes / 2
+	l, size := 0, 0
+	space, sizeAtSpace := 0, 0
+	for r, ch := range longString {
+		n := utf8.RuneLen(ch)
+		if ch == '\\' || ch == '\n' || ch == '"' {
+			n = 2
+		}
+		if size+n > limit && r > l {
+			cut := r
+			if space > l {
+				cut = space
+				size -= sizeAtSpace
+			} else {
+				size = 0
+			}
+			splits = append(splits, longString[l:cut])
+			l, space = cut, cut
+		}
+		size += n
+		if unicode.IsSpace(ch) {
+			space, sizeAtSpace = r+utf8.RuneLen(ch), size
 		}
-		splits = append(splits, longString[l:r])
 	}
 	splits = append(splits, longString[l:])
 	return splits
 }
 
 func (c *Conn) push(collection, bucket, object, text string) (err error) {
-	patterns := []struct {
-		Pattern     string
-		Replacement string
-	}{{"\\", "\\\\"},
-		{"\n", "\\n"},
-		{"\"", "\\\""}}
-	for _, v := range patterns {
-		text = strings.Replace(text, v.Pattern, v.Replacement, -1)
-	}
-
-	chunks := c.splitText(text)
 	// split chunks with partial success will yield single error
-	for _, chunk := range chunks {
-		err = c.write(fmt.Sprintf("%s %s %s %s \"%s\"", push, collection, bucket, object, chunk))
-
+	for _, chunk := range c.splitText(text) {
+		cmd, err := buildPush(collection, bucket, object, chunk, "")
 		if err != nil {
 			return err
 		}
 
 		// sonic should sent OK
-		_, err = c.read()
+		_, err = c.roundTrip(cmd)
 		if err != nil {
 			return err
 		}
@@ -317,124 +416,56 @@ func (c *Conn) push(collection, bucket, object, text string) (err error) {
 }
 
 func (c *Conn) Pop(collection, bucket, object, text string) (err error) {
-	err = c.write(fmt.Sprintf("%s %s %s %s \"%s\"", pop, collection, bucket, object, text))
-	if err != nil {
-		return err
-	}
-
-	// sonic should sent OK
-	_, err = c.read()
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = c.resultOf(NewCommand(string(pop)).Ident(collection).Ident(bucket).Ident(object).Text(text))
+	return err
 }
 
 func (c *Conn) Count(collection, bucket, object string) (cnt int, err error) {
-	err = c.write(fmt.Sprintf("%s %s %s", count, collection, buildCountQuery(bucket, object)))
-	if err != nil {
-		return 0, err
-	}
-
-	// RESULT NUMBER
-	r, err := c.read()
-	if err != nil {
-		return 0, err
-	}
-	return strconv.Atoi(r[7:])
-}
-
-func buildCountQuery(bucket, object string) string {
-	builder := strings.Builder{}
-	if bucket != "" {
-		builder.WriteString(bucket)
-		if object != "" {
-			builder.WriteString(" " + object)
-		}
-	}
-	return builder.String()
+	return c.resultOf(buildCount(collection, bucket, object))
 }
 
 func (c *Conn) FlushCollection(collection string) (err error) {
-	err = c.write(fmt.Sprintf("%s %s", flushc, collection))
-	if err != nil {
-		return err
-	}
-
-	// sonic should sent OK
-	_, err = c.read()
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = c.resultOf(NewCommand(string(flushc)).Ident(collection))
+	return err
 }
 
 func (c *Conn) FlushBucket(collection, bucket string) (err error) {
-	err = c.write(fmt.Sprintf("%s %s %s", flushb, collection, bucket))
-	if err != nil {
-		return err
-	}
-
-	// sonic should sent OK
-	_, err = c.read()
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = c.resultOf(NewCommand(string(flushb)).Ident(collection).Ident(bucket))
+	return err
 }
 
 func (c *Conn) FlushObject(collection, bucket, object string) (err error) {
-	err = c.write(fmt.Sprintf("%s %s %s %s", flusho, collection, bucket, object))
-	if err != nil {
-		return err
-	}
-
-	// sonic should sent OK
-	_, err = c.read()
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = c.resultOf(NewCommand(string(flusho)).Ident(collection).Ident(bucket).Ident(object))
+	return err
 }
 
-func (c *Conn) Query(collection, bucket, term string, limit, offset int) (results []string, err error) {
-	err = c.write(fmt.Sprintf("%s %s %s \"%s\" LIMIT(%d) OFFSET(%d)", query, collection, bucket, term, limit, offset))
+// resultOf 发送命令并解析 RESULT NUMBER
+func (c *Conn) resultOf(command *Command) (int, error) {
+	cmd, err := command.Build()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-
-	// pending, should be PENDING ID_EVENT
-	_, err = c.read()
+	r, err := c.roundTrip(cmd)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	return parseResult(r)
+}
 
-	// event query, should be EVENT QUERY ID_EVENT RESULT1 RESULT2 ...
-	read, err := c.read()
+func (c *Conn) Query(collection, bucket, term string, limit, offset int) (results []string, err error) {
+	cmd, err := buildQuery(collection, bucket, term, limit, offset, "").Build()
 	if err != nil {
 		return nil, err
 	}
-	return getSearchResults(read, string(query)), nil
+	return c.searchEvent(cmd, query)
 }
 
 func (c *Conn) Suggest(collection, bucket, word string, limit int) (results []string, err error) {
-	err = c.write(fmt.Sprintf("%s %s %s \"%s\" LIMIT(%d)", suggest, collection, bucket, word, limit))
-	if err != nil {
-		return nil, err
-	}
-
-	// pending, should be PENDING ID_EVENT
-	_, err = c.read()
-	if err != nil {
-		return nil, err
-	}
-
-	// event query, should be EVENT SUGGEST ID_EVENT RESULT1 RESULT2 ...
-	read, err := c.read()
+	cmd, err := buildSuggest(collection, bucket, word, limit).Build()
 	if err != nil {
 		return nil, err
 	}
-	return getSearchResults(read, string(suggest)), nil
+	return c.searchEvent(cmd, suggest)
 }
 
 func getSearchResults(line string, eventType string) []string {
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"TH9401/sonictest"
+)
+
+func newTestConn(t *testing.T, addr string, ch Channel) *Conn {
+	t.Helper()
+	netConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_ = netConn.SetDeadline(time.Now().Add(5 * time.Second))
+	cn, err := NewConn(netConn, ch, "secret")
+	if err != nil {
+		_ = netConn.Close()
+		t.Fatalf("NewConn: %v", err)
+	}
+	t.Cleanup(func() { _ = cn.Close() })
+	return cn
+}
+
+func TestConnRawMethods(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestConn(t, s.Addr(), Ingest)
+	search := newTestConn(t, s.Addr(), Search)
+
+	if err := ingest.push("c", "b", "o1", "say \"hello\"\nworld \\ ok"); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := ingest.push("c", "b", "o2", "hello"); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	if got, err := search.Query("c", "b", "hello", 10, 0); err != nil || !reflect.DeepEqual(got, []string{"o2", "o1"}) {
+		t.Fatalf("Query = %v, %v", got, err)
+	}
+	if got, err := search.Suggest("c", "b", "wor", 5); err != nil || !reflect.DeepEqual(got, []string{"world"}) {
+		t.Fatalf("Suggest = %v, %v", got, err)
+	}
+	if n, err := ingest.Count("c", "b", "o1"); err != nil || n != 4 {
+		t.Fatalf("Count = %d, %v, want 4", n, err)
+	}
+	if err := ingest.Pop("c", "b", "o1", "ok"); err != nil {
+		t.Fatalf("Pop: %v", err)
+	}
+	if err := ingest.FlushObject("c", "b", "o2"); err != nil {
+		t.Fatalf("FlushObject: %v", err)
+	}
+	if n, err := ingest.Count("c", "b", ""); err != nil || n != 1 {
+		t.Fatalf("Count = %d, %v, want 1", n, err)
+	}
+	if err := ingest.FlushBucket("c", "b"); err != nil {
+		t.Fatalf("FlushBucket: %v", err)
+	}
+	if err := ingest.FlushCollection("c"); err != nil {
+		t.Fatalf("FlushCollection: %v", err)
+	}
+}
+
+func TestConnRawRejectsInvalidIdent(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestConn(t, s.Addr(), Ingest)
+	search := newTestConn(t, s.Addr(), Search)
+
+	calls := map[string]error{
+		"push":            ingest.push("c", "b c", "o", "x"),
+		"Pop":             ingest.Pop("c", "b", "", "x"),
+		"FlushCollection": ingest.FlushCollection("c\n"),
+		"FlushBucket":     ingest.FlushBucket("c", "b\""),
+		"FlushObject":     ingest.FlushObject("c", "b", "o o"),
+	}
+	_, calls["Count"] = ingest.Count("c c", "", "")
+	_, calls["Query"] = search.Query("c", "", "x", 10, 0)
+	_, calls["Suggest"] = search.Suggest("c", "b b", "x", 5)
+	for name, err := range calls {
+		if !errors.Is(err, ErrInvalidIdent) {
+			t.Errorf("%s = %v, want ErrInvalidIdent", name, err)
+		}
+	}
+
+	// 不合法的命令没有发出去, 链接仍然可用
+	if _, err := ingest.Count("c", "", ""); err != nil {
+		t.Fatalf("Count after rejected commands: %v", err)
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+		ok   bool
+	}{
+		{"RESULT 42", 42, true},
+		{"RESULT 0", 0, true},
+		{"RESULT", 0, false},
+		{"RESULT ", 0, false},
+		{"RESULT x", 0, false},
+		{"OK", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		n, err := parseResult(tt.line)
+		if tt.ok && (err != nil || n != tt.want) {
+			t.Errorf("parseResult(%q) = %d, %v, want %d", tt.line, n, err, tt.want)
+		}
+		if !tt.ok && !errors.Is(err, ErrProtocol) {
+			t.Errorf("parseResult(%q) error = %v, want ErrProtocol", tt.line, err)
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	cn := &Conn{cmdMaxBytes: 40}
+	text := strings.Repeat("word ", 20) + strings.Repeat("\"", 30)
+
+	chunks := cn.splitText(text)
+	if got := strings.Join(chunks, ""); got != text {
+		t.Fatalf("chunks do not join back to the text: %q", got)
+	}
+	for _, chunk := range chunks {
+		if n := len(patternReplace(chunk)); n > 20 {
+			t.Errorf("escaped chunk %q is %d bytes, limit 20", chunk, n)
+		}
+		if strings.HasPrefix(chunk, "ord") || strings.HasPrefix(chunk, "rd") || strings.HasPrefix(chunk, "d ") {
+			t.Errorf("chunk %q starts in the middle of a word", chunk)
+		}
+	}
+}
+
+func TestParseHandshake(t *testing.T) {
+	if v, err := parseConnected("CONNECTED <sonic-server v1.4.9>"); err != nil || v != "sonic-server v1.4.9" {
+		t.Fatalf("parseConnected = %q, %v", v, err)
+	}
+	if _, err := parseConnected("STARTED search"); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("parseConnected of a wrong line = %v, want ErrProtocol", err)
+	}
+
+	hs, err := parseStarted("STARTED search protocol(1) buffer(20000)")
+	if err != nil || hs.Protocol != 1 || hs.BufferSize != 20000 {
+		t.Fatalf("parseStarted = %+v, %v", hs, err)
+	}
+	for _, line := range []string{
+		"CONNECTED <sonic-server v1.4.9>",
+		"STARTED search",
+		"STARTED search protocol(x) buffer(20000)",
+		"STARTED search protocol(1) buffer(0)",
+	} {
+		if _, err := parseStarted(line); !errors.Is(err, ErrProtocol) {
+			t.Errorf("parseStarted(%q) = %v, want ErrProtocol", line, err)
+		}
+	}
+}
+
+func TestConnHandshake(t *testing.T) {
+	s := newTestServer(t)
+	cn := newTestConn(t, s.Addr(), Search)
+
+	want := Handshake{ServerVersion: sonictest.Version, Protocol: 1, BufferSize: s.BufferSize}
+	if hs := cn.Handshake(); hs != want {
+		t.Fatalf("Handshake = %+v, want %+v", hs, want)
+	}
+}
+
+func TestConnReadTruncatedLine(t *testing.T) {
+	client, server := net.Pipe()
+	cn := &Conn{netConn: client, Reader: bufio.NewReader(client)}
+	go func() {
+		_, _ = server.Write([]byte("RESUL"))
+		_ = server.Close()
+	}()
+
+	// 半行回复之后链接断开, Read 不能把 "RESUL" 当作完整的一行
+	if line, err := cn.Read(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Read = %q, %v, want io.ErrUnexpectedEOF", line, err)
+	}
+	if _, err := cn.Read(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Read after truncated line = %v, want ErrClosed", err)
+	}
+}
+
+func TestConnRejectsInvalidPassword(t *testing.T) {
+	s := newTestServer(t)
+	for _, password := range []string{"", "a b", "secret\r\nFLUSHC c"} {
+		netConn, err := net.Dial("tcp", s.Addr())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		// 密码不合法时 START 不会发出去
+		if _, err := NewConn(netConn, Search, password); !errors.Is(err, ErrInvalidIdent) {
+			t.Errorf("NewConn with password %q = %v, want ErrInvalidIdent", password, err)
+		}
+		_ = netConn.Close()
+	}
+}
+
+func TestConnHandshakeEnded(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		_, _ = r.ReadString('\n') // START search wrong
+		_, _ = server.Write([]byte("CONNECTED <" + sonictest.Version + ">\r\nENDED invalid_authentication\r\n"))
+	}()
+
+	// 认证失败时 sonic 回复 ENDED, 不能当作无法解析的 STARTED 重试
+	_, err := NewConn(client, Search, "wrong")
+	var se *ServerError
+	if !errors.As(err, &se) || !se.Ended || !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("NewConn with ENDED = %v, want an ended ErrAuthFailed", err)
+	}
+	if DefaultRetryable(err) {
+		t.Fatal("ENDED invalid_authentication is retryable")
+	}
+}
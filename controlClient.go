@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type controlCommands string
+
+const (
+	trigger controlCommands = "TRIGGER"
+	info    controlCommands = "INFO"
+)
+
+// Action refer to the list of actions that can be triggered on control channel.
+type Action string
+
+const (
+	// Consolidate 将内存中的索引写入磁盘
+	Consolidate Action = "consolidate"
+
+	// Backup 备份数据库到指定路径
+	Backup Action = "backup"
+
+	// Restore 从指定路径恢复数据库
+	Restore Action = "restore"
+)
+
+// ServerInfo INFO 命令返回的服务器状态
+type ServerInfo struct {
+	Uptime              time.Duration
+	ClientsConnected    int
+	CommandsTotal       int
+	CommandLatencyBest  time.Duration
+	CommandLatencyWorst time.Duration
+	KVOpenCount         int
+	FSTOpenCount        int
+	FSTConsolidateCount int
+}
+
+// parseServerInfo 解析 INFO 的返回, 不认识的字段会被忽略
+func parseServerInfo(line string) (*ServerInfo, error) {
+	if !strings.HasPrefix(line, "RESULT ") {
+		return nil, fmt.Errorf("%w: unable to parse INFO response: %s", ErrProtocol, line)
+	}
+
+	si := &ServerInfo{}
+	ints := map[string]*int{
+		"clients_connected":     &si.ClientsConnected,
+		"commands_total":        &si.CommandsTotal,
+		"kv_open_count":         &si.KVOpenCount,
+		"fst_open_count":        &si.FSTOpenCount,
+		"fst_consolidate_count": &si.FSTConsolidateCount,
+	}
+	durations := map[string]struct {
+		v    *time.Duration
+		unit time.Duration
+	}{
+		"uptime":                {&si.Uptime, time.Second},
+		"command_latency_best":  {&si.CommandLatencyBest, time.Millisecond},
+		"command_latency_worst": {&si.CommandLatencyWorst, time.Millisecond},
+	}
+
+	for key, value := range parseFields(line[7:]) {
+		if p, ok := ints[key]; ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: unable to parse INFO field %s: %s", ErrProtocol, key, value)
+			}
+			*p = n
+			continue
+		}
+		if d, ok := durations[key]; ok {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: unable to parse INFO field %s: %s", ErrProtocol, key, value)
+			}
+			*d.v = time.Duration(n) * d.unit
+		}
+	}
+
+	return si, nil
+}
+
+// ControlClient ...
+type ControlClient struct {
+	channel  string
+	endpoint string
+	password string
+	port     int
+	pool     *ConnPool
+}
+
+// NewControlClient ...
+func NewControlClient(endpoint, password string, opts ...Option) (*ControlClient, error) {
+	return newControlClient(endpoint, password, applyOptions(controlDefaults(defaultOptions()), opts))
+}
+
+// controlDefaults control 通道用得少, 只需要很小的连接池, TRIGGER backup 比较慢, 读超时更长
+func controlDefaults(opt Options) Options {
+	opt.ReadTimeout = time.Second * 10
+	opt.PoolSize = 4
+	opt.MinIdleConns = 1
+	return opt
+}
+
+func newControlClient(endpoint, password string, opt Options) (*ControlClient, error) {
+	pool, err := newPool(endpoint, password, Control, opt)
+	if err != nil {
+		return nil, err
+	}
+	return &ControlClient{
+		pool:     pool,
+		endpoint: endpoint,
+		password: password,
+	}, nil
+}
+
+// Close 关闭连接池
+func (c *ControlClient) Close() error {
+	return c.pool.Close()
+}
+
+// Trigger 触发一个控制操作, backup 和 restore 需要传入路径
+func (c *ControlClient) Trigger(ctx context.Context, action Action, data string) (err error) {
+
+	command := NewCommand(string(trigger)).Ident(string(action))
+	if data != "" {
+		command.Ident(data)
+	}
+	cmd, err := command.Build()
+	if err != nil {
+		return err
+	}
+
+	return c.pool.withConn(ctx, func(conn *Conn) error {
+		err := conn.write(cmd)
+		if err != nil {
+			return err
+		}
+
+		// sonic should sent OK
+		_, err = conn.read()
+		return err
+	})
+}
+
+// Info 返回服务器状态
+func (c *ControlClient) Info(ctx context.Context) (si *ServerInfo, err error) {
+	cmd, err := NewCommand(string(info)).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.pool.withRetry(ctx, false, func(conn *Conn) error {
+		err := conn.write(cmd)
+		if err != nil {
+			return err
+		}
+
+		// RESULT uptime(...) clients_connected(...) ...
+		r, err := conn.read()
+		if err != nil {
+			return err
+		}
+
+		si, err = parseServerInfo(r)
+		return err
+	})
+	return si, err
+}
+
+// Handshake 返回服务端的握手信息, 可以据此判断支持的命令
+func (c *ControlClient) Handshake(ctx context.Context) (hs Handshake, err error) {
+	err = c.pool.withConn(ctx, func(conn *Conn) error {
+		hs = conn.Handshake()
+		return nil
+	})
+	return hs, err
+}
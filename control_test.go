@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestControlClient(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	c, err := NewControlClient(s.Addr(), "secret", WithMinIdle(0), quiet)
+	if err != nil {
+		t.Fatalf("NewControlClient: %v", err)
+	}
+	defer c.Close()
+
+	if err := ingest.Push(ctx, "c", "b", "o", "hello"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if err := c.Trigger(ctx, Consolidate, ""); err != nil {
+		t.Fatalf("Trigger consolidate: %v", err)
+	}
+	if err := c.Trigger(ctx, Backup, "snapshot"); err != nil {
+		t.Fatalf("Trigger backup: %v", err)
+	}
+	if _, err := ingest.FlushC(ctx, "c"); err != nil {
+		t.Fatalf("FlushC: %v", err)
+	}
+	if err := c.Trigger(ctx, Restore, "snapshot"); err != nil {
+		t.Fatalf("Trigger restore: %v", err)
+	}
+	if n, err := ingest.Count(ctx, "c", "b", ""); err != nil || n != 1 {
+		t.Fatalf("Count after restore = %d, %v, want 1", n, err)
+	}
+
+	if err := c.Trigger(ctx, Restore, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Trigger restore of a missing backup = %v, want ErrNotFound", err)
+	}
+	if err := c.Trigger(ctx, Backup, "two words"); !errors.Is(err, ErrInvalidIdent) {
+		t.Fatalf("Trigger backup with a bad path = %v, want ErrInvalidIdent", err)
+	}
+
+	si, err := c.Info(ctx)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if si.ClientsConnected < 1 || si.CommandsTotal < 1 {
+		t.Fatalf("Info = %+v, want connected clients and commands", si)
+	}
+
+	hs, err := c.Handshake(ctx)
+	if err != nil || hs.Protocol != 1 || hs.BufferSize != s.BufferSize {
+		t.Fatalf("Handshake = %+v, %v", hs, err)
+	}
+}
+
+func TestParseServerInfo(t *testing.T) {
+	si, err := parseServerInfo("RESULT uptime(120) clients_connected(3) commands_total(42) command_latency_best(1) command_latency_worst(250) kv_open_count(2) fst_open_count(1) fst_consolidate_count(5) new_field(x)")
+	if err != nil {
+		t.Fatalf("parseServerInfo: %v", err)
+	}
+	want := ServerInfo{
+		Uptime:              2 * time.Minute,
+		ClientsConnected:    3,
+		CommandsTotal:       42,
+		CommandLatencyBest:  time.Millisecond,
+		CommandLatencyWorst: 250 * time.Millisecond,
+		KVOpenCount:         2,
+		FSTOpenCount:        1,
+		FSTConsolidateCount: 5,
+	}
+	if *si != want {
+		t.Fatalf("parseServerInfo = %+v, want %+v", *si, want)
+	}
+
+	for _, line := range []string{"OK", "RESULT uptime(x)", "RESULT clients_connected(-)"} {
+		if _, err := parseServerInfo(line); !errors.Is(err, ErrProtocol) {
+			t.Errorf("parseServerInfo(%q) = %v, want ErrProtocol", line, err)
+		}
+	}
+}
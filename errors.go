@@ -0,0 +1,105 @@
+package client
+
+import (
+	"errors"
+	"strings"
+)
+
+// 服务端 ERR 和 ENDED 的分类, 可以通过 errors.Is 判断
+var (
+	ErrAuthFailed     = errors.New("sonic: authentication failed")
+	ErrInvalidFormat  = errors.New("sonic: invalid command format")
+	ErrCommandTooLong = errors.New("sonic: command exceeds buffer size")
+	ErrUnknownCommand = errors.New("sonic: unknown command")
+	ErrNotFound       = errors.New("sonic: not found")
+)
+
+// ErrProtocol 无法解析服务端的回复, 链接可能已经错位
+var ErrProtocol = errors.New("sonic: protocol error")
+
+// ErrNoHydrator 没有设置 Hydrator 时调用 QueryRecords
+var ErrNoHydrator = errors.New("sonic: no hydrator set")
+
+// ErrInvalidIdent collection, bucket, object 等标识符不合法
+var ErrInvalidIdent = errors.New("sonic: invalid identifier")
+
+// ErrInvalidArgument 语言代码、LIMIT、OFFSET 等参数不合法
+var ErrInvalidArgument = errors.New("sonic: invalid argument")
+
+// serverErrorKinds ERR 和 ENDED 原因前缀和分类的对应关系
+var serverErrorKinds = []struct {
+	prefix string
+	kind   error
+}{
+	{"authentication_required", ErrAuthFailed},
+	{"invalid_authentication", ErrAuthFailed},
+	{"authentication_failed", ErrAuthFailed},
+	{"invalid_format", ErrInvalidFormat},
+	{"invalid_meta_key", ErrInvalidFormat},
+	{"invalid_meta_value", ErrInvalidFormat},
+	{"buffer_overflow", ErrCommandTooLong},
+	{"line_too_long", ErrCommandTooLong},
+	{"unknown_command", ErrUnknownCommand},
+	{"not_recognized", ErrUnknownCommand},
+	{"not_found", ErrNotFound},
+}
+
+// ServerError 服务端返回的 ERR 或 ENDED
+type ServerError struct {
+	Reason string // ERR 或 ENDED 之后的原始内容
+	Ended  bool   // 服务端回复 ENDED 并关闭了链接, 例如 START 认证失败
+	kind   error
+}
+
+func newServerError(reason string) *ServerError {
+	e := &ServerError{Reason: reason}
+	for _, k := range serverErrorKinds {
+		if strings.HasPrefix(reason, k.prefix) {
+			e.kind = k.kind
+			break
+		}
+	}
+	return e
+}
+
+// newEndedError START 失败或服务器关闭时 sonic 回复 ENDED <reason> 并断开链接
+func newEndedError(reason string) *ServerError {
+	e := newServerError(reason)
+	e.Ended = true
+	return e
+}
+
+func (e *ServerError) Error() string {
+	return "sonic: " + e.Reason
+}
+
+// Unwrap 返回错误分类, 未知原因返回 nil
+func (e *ServerError) Unwrap() error {
+	return e.kind
+}
+
+// reusable 出现该错误后链接是否还能继续使用
+// 认证失败、命令超长或服务器关闭时 sonic 会断开链接
+func (e *ServerError) reusable() bool {
+	if e.Ended {
+		return false
+	}
+	switch e.kind {
+	case ErrAuthFailed, ErrCommandTooLong:
+		return false
+	}
+	return !strings.HasPrefix(e.Reason, "shutting_down")
+}
+
+// isBadConn 判断出错后链接是否还能放回连接池
+func isBadConn(err error) bool {
+	if err == nil {
+		return false
+	}
+	var se *ServerError
+	if errors.As(err, &se) {
+		return !se.reusable()
+	}
+	// 命令在发送前就没通过检查, 链接没有被使用过
+	return !errors.Is(err, ErrInvalidIdent) && !errors.Is(err, ErrInvalidArgument)
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestServerError(t *testing.T) {
+	tests := []struct {
+		reason   string
+		kind     error
+		reusable bool
+	}{
+		{"authentication_failed", ErrAuthFailed, false},
+		{"invalid_format(PUSH <collection>)", ErrInvalidFormat, true},
+		{"buffer_overflow", ErrCommandTooLong, false},
+		{"unknown_command", ErrUnknownCommand, true},
+		{"not_found", ErrNotFound, true},
+		{"query_error", nil, true},
+		{"shutting_down", nil, false},
+	}
+	for _, tt := range tests {
+		e := newServerError(tt.reason)
+		if e.Error() != "sonic: "+tt.reason {
+			t.Errorf("Error() = %q", e.Error())
+		}
+		if errors.Unwrap(e) != tt.kind {
+			t.Errorf("%s: Unwrap = %v, want %v", tt.reason, errors.Unwrap(e), tt.kind)
+		}
+		if e.reusable() != tt.reusable {
+			t.Errorf("%s: reusable = %v, want %v", tt.reason, e.reusable(), tt.reusable)
+		}
+		if isBadConn(e) == tt.reusable {
+			t.Errorf("%s: isBadConn = %v", tt.reason, isBadConn(e))
+		}
+	}
+}
+
+func TestEndedError(t *testing.T) {
+	tests := []struct {
+		reason string
+		kind   error
+	}{
+		{"invalid_authentication", ErrAuthFailed},
+		{"authentication_required", ErrAuthFailed},
+		{"not_recognized", ErrUnknownCommand},
+		{"invalid_mode", nil},
+		{"shutting_down", nil},
+	}
+	for _, tt := range tests {
+		e := newEndedError(tt.reason)
+		if errors.Unwrap(e) != tt.kind {
+			t.Errorf("%s: Unwrap = %v, want %v", tt.reason, errors.Unwrap(e), tt.kind)
+		}
+		// ENDED 之后服务端已经断开链接
+		if e.reusable() || !isBadConn(e) {
+			t.Errorf("%s: ENDED conn is reusable", tt.reason)
+		}
+	}
+}
+
+func TestServerErrorFromServer(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestSearch(t, s.Addr())
+	ctx := testCtx(t)
+
+	_, err := c.Suggest(ctx, "c", "b", "two words", 5)
+	var se *ServerError
+	if !errors.As(err, &se) || !errors.Is(err, ErrInvalidFormat) {
+		t.Fatalf("Suggest with two words = %v, want ErrInvalidFormat", err)
+	}
+	if n := c.pool.Len(); n != 1 {
+		t.Fatalf("conn was not reused after a reusable ERR: Len = %d", n)
+	}
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ping 所有通道都支持的 PING 命令
+const ping = "PING"
+
+// ping 通过池中的链接发送 PING, 检查服务是否可用
+func (p *ConnPool) ping(ctx context.Context) error {
+	return p.withConn(ctx, func(conn *Conn) error {
+		r, err := conn.roundTrip(ping)
+		if err != nil {
+			return err
+		}
+		if r != "PONG" {
+			return fmt.Errorf("%w: unexpected PING response: %s", ErrProtocol, r)
+		}
+		return nil
+	})
+}
+
+// Ping 检查服务是否可用
+func (c *SearchClient) Ping(ctx context.Context) error {
+	return c.pool.ping(ctx)
+}
+
+// Ping 检查服务是否可用
+func (c *IngestClient) Ping(ctx context.Context) error {
+	return c.pool.ping(ctx)
+}
+
+// FailoverOptions FailoverClient 的配置, 零值使用默认配置
+type FailoverOptions struct {
+	HealthCheckInterval time.Duration // 健康检查间隔, 默认 5s
+	HealthCheckTimeout  time.Duration // 每次 PING 的超时时间, 默认 1s
+}
+
+// endpointClients 一个 sonic 实例上的客户端
+type endpointClients struct {
+	endpoint string
+	search   *SearchClient
+	ingest   *IngestClient
+	healthy  int32 // atomic, 1 表示健康
+}
+
+func (e *endpointClients) isHealthy() bool {
+	return atomic.LoadInt32(&e.healthy) == 1
+}
+
+func (e *endpointClients) setHealthy(ok bool) {
+	var v int32
+	if ok {
+		v = 1
+	}
+	atomic.StoreInt32(&e.healthy, v)
+}
+
+// ErrNoEndpoints 没有传入任何地址
+var ErrNoEndpoints = errors.New("sonic: no endpoints")
+
+// FailoverClient 连接多个 sonic 实例, 第一个为主实例, 其余为按顺序的备用实例
+// 搜索会切换到下一个健康的实例, 写入默认只发给主实例
+type FailoverClient struct {
+	endpoints []*endpointClients
+	fo        FailoverOptions
+
+	_closed uint32 // atomic
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewFailoverClient 为每个地址创建独立的连接池, 并在后台定期做健康检查
+// ctx 用于第一次健康检查
+func NewFailoverClient(ctx context.Context, endpoints []string, password string, fo FailoverOptions, opts ...Option) (*FailoverClient, error) {
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	if fo.HealthCheckInterval <= 0 {
+		fo.HealthCheckInterval = time.Second * 5
+	}
+	if fo.HealthCheckTimeout <= 0 {
+		fo.HealthCheckTimeout = time.Second
+	}
+
+	opt := applyOptions(defaultOptions(), opts)
+	c := &FailoverClient{fo: fo, stop: make(chan struct{})}
+	for _, endpoint := range endpoints {
+		search, err := newSearchClient(endpoint, password, opt)
+		if err != nil {
+			_ = c.closeClients()
+			return nil, err
+		}
+		ingest, err := newIngestClient(endpoint, password, opt)
+		if err != nil {
+			_ = search.Close()
+			_ = c.closeClients()
+			return nil, err
+		}
+		c.endpoints = append(c.endpoints, &endpointClients{
+			endpoint: endpoint,
+			search:   search,
+			ingest:   ingest,
+		})
+	}
+
+	c.check(ctx)
+
+	c.wg.Add(1)
+	go c.healthCheck()
+	return c, nil
+}
+
+// healthCheck 定期 PING 每个实例
+func (c *FailoverClient) healthCheck() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.fo.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.check(context.Background())
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// check 并发 PING 所有实例并更新健康状态
+func (c *FailoverClient) check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range c.endpoints {
+		wg.Add(1)
+		go func(e *endpointClients) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.fo.HealthCheckTimeout)
+			defer cancel()
+			e.setHealthy(e.search.Ping(ctx) == nil)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// Healthy 返回当前健康的实例地址, 按优先级排列
+func (c *FailoverClient) Healthy() []string {
+	var endpoints []string
+	for _, e := range c.endpoints {
+		if e.isHealthy() {
+			endpoints = append(endpoints, e.endpoint)
+		}
+	}
+	return endpoints
+}
+
+// candidates 按顺序返回健康的实例, 都不健康时返回全部实例
+func (c *FailoverClient) candidates() []*endpointClients {
+	var list []*endpointClients
+	for _, e := range c.endpoints {
+		if e.isHealthy() {
+			list = append(list, e)
+		}
+	}
+	if len(list) == 0 {
+		return c.endpoints
+	}
+	return list
+}
+
+// shouldFailover 只有拨号、连接池和读写错误才切换实例, 熔断和认证失败说明这个实例暂时不可用
+// 参数错误和服务端拒绝的命令换一个实例也一样会失败, ctx 结束后也不再切换
+// 本地连接池等待超时只说明调用方太多, 实例本身是好的, 切换到下一个实例但不标记为不健康
+func shouldFailover(ctx context.Context, err error) (next, unhealthy bool) {
+	if err == nil || ctx.Err() != nil {
+		return false, false
+	}
+	if errors.Is(err, ErrPoolTimeout) {
+		return true, false
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrAuthFailed) {
+		return true, true
+	}
+	next = DefaultRetryable(err)
+	return next, next
+}
+
+// search 依次在健康的实例上执行, 出错时切换到下一个, 实例不可用时标记为不健康
+func (c *FailoverClient) search(ctx context.Context, fn func(*SearchClient) ([]string, error)) (results []string, err error) {
+	for _, e := range c.candidates() {
+		results, err = fn(e.search)
+		next, unhealthy := shouldFailover(ctx, err)
+		if !next {
+			return results, err
+		}
+		if unhealthy {
+			e.setHealthy(false)
+		}
+	}
+	return results, err
+}
+
+// Query ...
+func (c *FailoverClient) Query(ctx context.Context, collection, bucket, term string, limit, offset int, opts ...CommandOption) ([]string, error) {
+	return c.search(ctx, func(s *SearchClient) ([]string, error) {
+		return s.Query(ctx, collection, bucket, term, limit, offset, opts...)
+	})
+}
+
+// Suggest ...
+func (c *FailoverClient) Suggest(ctx context.Context, collection, bucket, word string, limit int) ([]string, error) {
+	return c.search(ctx, func(s *SearchClient) ([]string, error) {
+		return s.Suggest(ctx, collection, bucket, word, limit)
+	})
+}
+
+// List ...
+func (c *FailoverClient) List(ctx context.Context, collection, bucket string, limit, offset int) ([]string, error) {
+	return c.search(ctx, func(s *SearchClient) ([]string, error) {
+		return s.List(ctx, collection, bucket, limit, offset)
+	})
+}
+
+// Ingest 返回主实例的写入客户端, 不会切换实例
+func (c *FailoverClient) Ingest() *IngestClient {
+	return c.endpoints[0].ingest
+}
+
+// IngestAny 返回第一个健康实例的写入客户端, 主实例不可用时会写入备用实例
+// 备用实例是从备份恢复的, 写入的数据不会同步回主实例, 调用方需要明确知道这一点
+func (c *FailoverClient) IngestAny() *IngestClient {
+	return c.candidates()[0].ingest
+}
+
+// Close 停止健康检查并关闭所有连接池, 重复关闭返回 ErrClosed
+func (c *FailoverClient) Close() error {
+	if !atomic.CompareAndSwapUint32(&c._closed, 0, 1) {
+		return ErrClosed
+	}
+	close(c.stop)
+	c.wg.Wait()
+	return c.closeClients()
+}
+
+func (c *FailoverClient) closeClients() error {
+	var firstErr error
+	for _, e := range c.endpoints {
+		for _, closer := range []func() error{e.search.Close, e.ingest.Close} {
+			if err := closer(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"TH9401/sonictest"
+)
+
+func newTestFailover(t *testing.T, servers ...*sonictest.Server) *FailoverClient {
+	t.Helper()
+	var endpoints []string
+	for _, s := range servers {
+		endpoints = append(endpoints, s.Addr())
+	}
+	fc, err := NewFailoverClient(testCtx(t), endpoints, "secret",
+		FailoverOptions{HealthCheckInterval: 50 * time.Millisecond},
+		WithMinIdle(0), WithPoolTimeout(200*time.Millisecond), quiet)
+	if err != nil {
+		t.Fatalf("NewFailoverClient: %v", err)
+	}
+	t.Cleanup(func() { _ = fc.Close() })
+	return fc
+}
+
+func TestFailoverBadArgumentKeepsReplicasHealthy(t *testing.T) {
+	primary, standby := newTestServer(t), newTestServer(t)
+	fc := newTestFailover(t, primary, standby)
+	ctx := testCtx(t)
+
+	want := []string{primary.Addr(), standby.Addr()}
+	if got := fc.Healthy(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Healthy = %v, want %v", got, want)
+	}
+
+	if _, err := fc.Query(ctx, "c", "b", "x", 10, 0, WithLang("xx")); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("Query with bad lang = %v, want ErrInvalidArgument", err)
+	}
+	if _, err := fc.Query(ctx, "c", "b", "x", -1, 0); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("Query with negative limit = %v, want ErrInvalidArgument", err)
+	}
+	if _, err := fc.List(ctx, "c", "b c", 10, 0); !errors.Is(err, ErrInvalidIdent) {
+		t.Fatalf("List with bad bucket = %v, want ErrInvalidIdent", err)
+	}
+	if _, err := fc.Suggest(ctx, "c", "b", "two words", 5); err == nil {
+		t.Fatal("Suggest rejected by the server returned nil error")
+	}
+
+	if got := fc.Healthy(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Healthy after caller errors = %v, want %v", got, want)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	primary, standby := newTestServer(t), newTestServer(t)
+	fc := newTestFailover(t, primary, standby)
+	ctx := testCtx(t)
+
+	if err := fc.Ingest().Push(ctx, "c", "b", "p1", "hello"); err != nil {
+		t.Fatalf("Push to primary: %v", err)
+	}
+	standbyIngest := newTestIngest(t, standby)
+	if err := standbyIngest.Push(ctx, "c", "b", "s1", "hello"); err != nil {
+		t.Fatalf("Push to standby: %v", err)
+	}
+
+	if got, err := fc.Query(ctx, "c", "b", "hello", 10, 0); err != nil || !reflect.DeepEqual(got, []string{"p1"}) {
+		t.Fatalf("Query = %v, %v, want results from the primary", got, err)
+	}
+
+	primary.Close()
+
+	// 搜索切换到备用实例
+	if got, err := fc.Query(ctx, "c", "b", "hello", 10, 0); err != nil || !reflect.DeepEqual(got, []string{"s1"}) {
+		t.Fatalf("Query after primary went down = %v, %v, want results from the standby", got, err)
+	}
+	if got := fc.Healthy(); !reflect.DeepEqual(got, []string{standby.Addr()}) {
+		t.Fatalf("Healthy = %v, want only the standby", got)
+	}
+
+	// 写入默认不切换
+	if err := fc.Ingest().Push(ctx, "c", "b", "p2", "hello"); err == nil {
+		t.Fatal("Ingest pushed to a replica other than the primary")
+	}
+	if err := fc.IngestAny().Push(ctx, "c", "b", "s2", "hello"); err != nil {
+		t.Fatalf("IngestAny Push: %v", err)
+	}
+	if n, err := standbyIngest.Count(ctx, "c", "b", ""); err != nil || n != 2 {
+		t.Fatalf("standby Count = %d, %v, want 2", n, err)
+	}
+}
+
+// 本地连接池满了只说明调用方太多, 实例本身是好的
+func TestFailoverPoolTimeoutKeepsPrimaryHealthy(t *testing.T) {
+	primary, standby := newTestServer(t), newTestServer(t)
+	fc, err := NewFailoverClient(testCtx(t), []string{primary.Addr(), standby.Addr()}, "secret",
+		FailoverOptions{HealthCheckInterval: time.Minute},
+		WithPoolSize(1), WithMinIdle(0), WithPoolTimeout(50*time.Millisecond), quiet)
+	if err != nil {
+		t.Fatalf("NewFailoverClient: %v", err)
+	}
+	defer fc.Close()
+	ctx := testCtx(t)
+
+	primary.Conns("search").SetDelay(300 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = fc.Query(ctx, "c", "b", "hello", 10, 0)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Query %d: %v", i, err)
+		}
+	}
+	want := []string{primary.Addr(), standby.Addr()}
+	if got := fc.Healthy(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Healthy after a saturated pool = %v, want %v", got, want)
+	}
+}
+
+func TestFailoverCloseTwice(t *testing.T) {
+	fc := newTestFailover(t, newTestServer(t))
+	if err := fc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := fc.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("second Close = %v, want ErrClosed", err)
+	}
+}
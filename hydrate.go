@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Hydrator 把对象 ID 转换成业务数据
+// 返回的 map 以 ID 为键, 不存在的 ID 不需要出现在 map 中
+type Hydrator interface {
+	Hydrate(ctx context.Context, collection, bucket string, ids []string) (map[string]interface{}, error)
+}
+
+// HydratorFunc 让普通函数满足 Hydrator 接口
+type HydratorFunc func(ctx context.Context, collection, bucket string, ids []string) (map[string]interface{}, error)
+
+// Hydrate ...
+func (f HydratorFunc) Hydrate(ctx context.Context, collection, bucket string, ids []string) (map[string]interface{}, error) {
+	return f(ctx, collection, bucket, ids)
+}
+
+// HydrateOptions SetHydrator 的参数
+type HydrateOptions struct {
+	BatchSize int // 每次传给 Hydrator 的最大 ID 数, 0 表示一次全部传入
+
+	// Cleanup 不为空时, Hydrator 没有返回的 ID 会排队由后台协程通过 FlushO 从索引中删除
+	Cleanup        *IngestClient
+	CleanupTimeout time.Duration // 每次 FlushO 的超时时间, 默认 5s
+	CleanupQueue   int           // 排队等待删除的查询数, 队列满时丢弃, 默认 64
+}
+
+type hydration struct {
+	h   Hydrator
+	opt HydrateOptions
+
+	queue  chan cleanupJob
+	ctx    context.Context // SearchClient 关闭时取消, 后台协程随之退出
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// cleanupJob 一次查询中已经不存在的对象
+type cleanupJob struct {
+	collection string
+	bucket     string
+	ids        []string
+}
+
+// SetHydrator 设置 QueryRecords 使用的 Hydrator, 需要在使用客户端之前调用
+func (c *SearchClient) SetHydrator(h Hydrator, opt HydrateOptions) {
+	if opt.CleanupTimeout <= 0 {
+		opt.CleanupTimeout = time.Second * 5
+	}
+	if opt.CleanupQueue <= 0 {
+		opt.CleanupQueue = 64
+	}
+	if c.hydration != nil {
+		c.hydration.close()
+	}
+
+	hy := &hydration{h: h, opt: opt}
+	if opt.Cleanup != nil {
+		hy.queue = make(chan cleanupJob, opt.CleanupQueue)
+		hy.ctx, hy.cancel = context.WithCancel(context.Background())
+		hy.done = make(chan struct{})
+		go hy.cleanup()
+	}
+	c.hydration = hy
+}
+
+// QueryRecords 执行 QUERY 并通过 Hydrator 返回业务数据
+// 结果保持 sonic 的排名顺序, 已经不存在的 ID 会被丢弃
+func (c *SearchClient) QueryRecords(ctx context.Context, collection, bucket, term string, limit, offset int, opts ...CommandOption) ([]interface{}, error) {
+	if c.hydration == nil {
+		return nil, ErrNoHydrator
+	}
+
+	ids, err := c.Query(ctx, collection, bucket, term, limit, offset, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := c.hydration.hydrate(ctx, collection, bucket, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]interface{}, 0, len(ids))
+	var stale []string
+	for _, id := range ids {
+		if r, ok := records[id]; ok {
+			results = append(results, r)
+		} else {
+			stale = append(stale, id)
+		}
+	}
+
+	if len(stale) > 0 && c.hydration.queue != nil {
+		c.hydration.enqueue(cleanupJob{collection, bucket, stale})
+	}
+	return results, nil
+}
+
+// hydrate 按 BatchSize 分批调用 Hydrator
+func (h *hydration) hydrate(ctx context.Context, collection, bucket string, ids []string) (map[string]interface{}, error) {
+	size := h.opt.BatchSize
+	if size <= 0 {
+		size = len(ids)
+	}
+
+	records := make(map[string]interface{}, len(ids))
+	for l := 0; l < len(ids); l += size {
+		r := l + size
+		if r > len(ids) {
+			r = len(ids)
+		}
+		batch, err := h.h.Hydrate(ctx, collection, bucket, ids[l:r])
+		if err != nil {
+			return nil, err
+		}
+		for id, record := range batch {
+			records[id] = record
+		}
+	}
+	return records, nil
+}
+
+// enqueue 把需要删除的对象放入队列, 队列满时丢弃, 不阻塞查询
+func (h *hydration) enqueue(job cleanupJob) {
+	select {
+	case h.queue <- job:
+	default:
+		h.opt.Cleanup.pool.logf("hydrate: cleanup queue is full, dropping %d ids in %s/%s", len(job.ids), job.collection, job.bucket)
+	}
+}
+
+// cleanup 后台协程, 依次从索引中删除已经不存在的对象
+func (h *hydration) cleanup() {
+	defer close(h.done)
+
+	ingest := h.opt.Cleanup
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case job := <-h.queue:
+			for _, id := range job.ids {
+				ctx, cancel := context.WithTimeout(h.ctx, h.opt.CleanupTimeout)
+				_, err := ingest.FlushO(ctx, job.collection, job.bucket, id)
+				cancel()
+				if h.ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					ingest.pool.logf("FlushO %s/%s/%s failed: %s", job.collection, job.bucket, id, err)
+				}
+			}
+		}
+	}
+}
+
+// close 停止后台协程, 队列中还没有删除的对象会被丢弃
+func (h *hydration) close() {
+	if h.cancel == nil {
+		return
+	}
+	h.cancel()
+	<-h.done
+}
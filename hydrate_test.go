@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryRecords(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	search := newTestSearch(t, s.Addr())
+	ctx := testCtx(t)
+
+	if _, err := search.QueryRecords(ctx, "c", "b", "hello", 10, 0); !errors.Is(err, ErrNoHydrator) {
+		t.Fatalf("QueryRecords without hydrator = %v, want ErrNoHydrator", err)
+	}
+
+	for _, id := range []string{"a", "gone", "b"} {
+		if err := ingest.Push(ctx, "c", "b", id, "hello"); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+
+	var batches [][]string
+	search.SetHydrator(HydratorFunc(func(ctx context.Context, collection, bucket string, ids []string) (map[string]interface{}, error) {
+		batches = append(batches, ids)
+		records := make(map[string]interface{})
+		for _, id := range ids {
+			if id != "gone" {
+				records[id] = "record " + id
+			}
+		}
+		return records, nil
+	}), HydrateOptions{BatchSize: 2, Cleanup: ingest})
+
+	got, err := search.QueryRecords(ctx, "c", "b", "hello", 10, 0)
+	if err != nil {
+		t.Fatalf("QueryRecords: %v", err)
+	}
+	if want := []interface{}{"record b", "record a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("QueryRecords = %v, want %v", got, want)
+	}
+	if want := [][]string{{"b", "gone"}, {"a"}}; !reflect.DeepEqual(batches, want) {
+		t.Fatalf("hydrator batches = %v, want %v", batches, want)
+	}
+
+	// 已经不存在的对象由后台协程从索引中删除
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n, err := ingest.Count(ctx, "c", "b", "")
+		if err == nil && n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stale object not flushed: Count = %d, %v", n, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHydrationCleanupStopsOnClose(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+
+	search, err := NewSearchClient(s.Addr(), "secret", WithMinIdle(0), quiet)
+	if err != nil {
+		t.Fatalf("NewSearchClient: %v", err)
+	}
+	search.SetHydrator(HydratorFunc(func(ctx context.Context, collection, bucket string, ids []string) (map[string]interface{}, error) {
+		return nil, nil
+	}), HydrateOptions{Cleanup: ingest, CleanupQueue: 1})
+
+	// 清理很慢时队列很快就满了, 多出来的会被丢弃, 查询不会被阻塞
+	s.Conns("ingest").SetDelay(200 * time.Millisecond)
+	defer s.ResetFaults()
+	for i := 0; i < 10; i++ {
+		search.hydration.enqueue(cleanupJob{"c", "b", []string{"o1", "o2", "o3"}})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = search.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on the cleanup worker")
+	}
+}
@@ -1,12 +1,8 @@
 package client
 
 import (
-	"bytes"
 	"context"
-	"net"
-	"strconv"
 	"strings"
-	"time"
 )
 
 // PATTERNS ...
@@ -38,41 +34,33 @@ type IngestClient struct {
 }
 
 // NewIngestCient ...
+//
+// Deprecated: 使用 NewIngestClient
 func NewIngestCient(endpoint, password string, port int) (client *IngestClient) {
+	client, _ = NewIngestClient(joinEndpoint(endpoint, port), password)
+	return
+}
 
-	dialer := func(ctx context.Context) (netConn net.Conn, err error) {
-		netConn, err = net.Dial("tcp", endpoint)
-		if err != nil {
-			return nil, err
-		}
-		return
-	}
-
-	connector := func(ctx context.Context, netConn net.Conn) (conn *Conn, err error) {
-		return NewConn(netConn, Ingest, password)
-	}
-
-	opt := &Options{
-		Dialer:    dialer,
-		OnClose:   nil,
-		Connector: connector,
+// NewIngestClient ...
+func NewIngestClient(endpoint, password string, opts ...Option) (*IngestClient, error) {
+	return newIngestClient(endpoint, password, applyOptions(defaultOptions(), opts))
+}
 
-		PoolSize:           40,
-		MinIdleConns:       10,
-		MaxConnAge:         time.Minute,
-		PoolTimeout:        time.Second * 2,
-		IdleTimeout:        time.Second * 30,
-		IdleCheckFrequency: time.Second * 2,
+func newIngestClient(endpoint, password string, opt Options) (*IngestClient, error) {
+	pool, err := newPool(endpoint, password, Ingest, opt)
+	if err != nil {
+		return nil, err
 	}
-
-	client = &IngestClient{
-		pool:     NewConnPool(opt),
+	return &IngestClient{
+		pool:     pool,
 		endpoint: endpoint,
 		password: password,
-		port:     port,
-	}
+	}, nil
+}
 
-	return
+// Close 关闭连接池
+func (c *IngestClient) Close() error {
+	return c.pool.Close()
 }
 
 func patternReplace(text string) string {
@@ -83,201 +71,113 @@ func patternReplace(text string) string {
 }
 
 // Push ...
-func (c *IngestClient) Push(ctx context.Context, collection, bucket, object, text string) (err error) {
+func (c *IngestClient) Push(ctx context.Context, collection, bucket, object, text string, opts ...CommandOption) (err error) {
 
-	conn, err := c.pool.Get(ctx)
+	o, err := newCommandOptions(opts)
 	if err != nil {
 		return err
 	}
 
-	text = patternReplace(text)
-
-	chunks := conn.splitText(text)
+	return c.pool.withRetry(ctx, true, func(conn *Conn) error {
+		chunks := conn.splitText(text)
 
-	var buf bytes.Buffer
-	// split chunks with partial success will yield single error
-	for _, chunk := range chunks {
-		buf.Reset()
+		// split chunks with partial success will yield single error
+		for _, chunk := range chunks {
+			cmd, err := buildPush(collection, bucket, object, chunk, o.lang)
+			if err != nil {
+				return err
+			}
 
-		buf.WriteString(string(push))
-		buf.WriteString(" ")
-		buf.WriteString(collection)
-		buf.WriteString(" ")
-		buf.WriteString(bucket)
-		buf.WriteString(" ")
-		buf.WriteString(object)
-		buf.WriteString("\"")
-		buf.WriteString(chunk)
-		buf.WriteString("\"")
-
-		err = conn.write(buf.String())
-
-		if err != nil {
-			return err
+			// sonic should sent OK
+			_, err = conn.roundTrip(cmd)
+			if err != nil {
+				return err
+			}
 		}
 
-		// sonic should sent OK
-		_, err = conn.read()
-		if err != nil {
-			return err
-		}
-	}
+		return nil
+	})
+}
 
-	return nil
+func buildPush(collection, bucket, object, chunk, lang string) (string, error) {
+	cmd := NewCommand(string(push)).Ident(collection).Ident(bucket).Ident(object).Text(chunk)
+	if lang != "" {
+		cmd.Param("LANG", lang)
+	}
+	return cmd.Build()
 }
 
 // Pop ...
 func (c *IngestClient) Pop(ctx context.Context, collection, bucket, object, text string) (err error) {
 
-	conn, err := c.pool.Get(ctx)
+	cmd, err := NewCommand(string(pop)).Ident(collection).Ident(bucket).Ident(object).Text(text).Build()
 	if err != nil {
 		return err
 	}
 
-	var buf bytes.Buffer
-
-	buf.WriteString(string(pop))
-	buf.WriteString(" ")
-	buf.WriteString(collection)
-	buf.WriteString(" ")
-	buf.WriteString(bucket)
-	buf.WriteString(" ")
-	buf.WriteString(object)
-	buf.WriteString("\"")
-	buf.WriteString(text)
-	buf.WriteString("\"")
-
-	err = conn.write(buf.String())
-	if err != nil {
-		return err
-	}
+	return c.pool.withRetry(ctx, true, func(conn *Conn) error {
+		err := conn.write(cmd)
+		if err != nil {
+			return err
+		}
 
-	// sonic should sent OK
-	_, err = conn.read()
-	if err != nil {
+		// sonic should sent RESULT NUMBER
+		_, err = conn.read()
 		return err
-	}
-	return nil
+	})
 }
 
-// Count ...
+// Count 只传 collection 时返回 bucket 数, 传 bucket 时返回对象数, 传 object 时返回词数
 func (c *IngestClient) Count(ctx context.Context, collection, bucket, object string) (cnt int, err error) {
 
-	conn, err := c.pool.Get(ctx)
-	if err != nil {
-		return
-	}
-
-	var buf bytes.Buffer
-
-	buf.WriteString(string(count))
-	buf.WriteString(" ")
-	buf.WriteString(collection)
-	buf.WriteString(" ")
-	buf.WriteString(bucket)
-	buf.WriteString(" ")
-	buf.WriteString(object)
-
-	err = conn.write(buf.String())
-	if err != nil {
-		return 0, err
-	}
+	return c.result(ctx, buildCount(collection, bucket, object))
+}
 
-	// RESULT NUMBER
-	r, err := conn.read()
-	if err != nil {
-		return 0, err
+func buildCount(collection, bucket, object string) *Command {
+	cmd := NewCommand(string(count)).Ident(collection)
+	if bucket != "" {
+		cmd.Ident(bucket)
+		if object != "" {
+			cmd.Ident(object)
+		}
 	}
-
-	return strconv.Atoi(r[7:])
+	return cmd
 }
 
 // FlushB ...
 func (c *IngestClient) FlushB(ctx context.Context, collection, bucket string) (cnt int, err error) {
-
-	conn, err := c.pool.Get(ctx)
-	if err != nil {
-		return
-	}
-
-	var buf bytes.Buffer
-
-	buf.WriteString(string(flushb))
-	buf.WriteString(" ")
-	buf.WriteString(collection)
-	buf.WriteString(" ")
-	buf.WriteString(bucket)
-
-	err = conn.write(buf.String())
-	if err != nil {
-		return 0, err
-	}
-
-	// RESULT NUMBER
-	r, err := conn.read()
-	if err != nil {
-		return 0, err
-	}
-
-	return strconv.Atoi(r[7:])
+	return c.result(ctx, NewCommand(string(flushb)).Ident(collection).Ident(bucket))
 }
 
 // FlushC ...
 func (c *IngestClient) FlushC(ctx context.Context, collection string) (cnt int, err error) {
-
-	conn, err := c.pool.Get(ctx)
-	if err != nil {
-		return
-	}
-
-	var buf bytes.Buffer
-
-	buf.WriteString(string(flushc))
-	buf.WriteString(" ")
-	buf.WriteString(collection)
-
-	err = conn.write(buf.String())
-	if err != nil {
-		return 0, err
-	}
-
-	// RESULT NUMBER
-	r, err := conn.read()
-	if err != nil {
-		return 0, err
-	}
-
-	return strconv.Atoi(r[7:])
+	return c.result(ctx, NewCommand(string(flushc)).Ident(collection))
 }
 
 // FlushO ...
 func (c *IngestClient) FlushO(ctx context.Context, collection, bucket, object string) (cnt int, err error) {
+	return c.result(ctx, NewCommand(string(flusho)).Ident(collection).Ident(bucket).Ident(object))
+}
 
-	conn, err := c.pool.Get(ctx)
-	if err != nil {
-		return
-	}
-
-	var buf bytes.Buffer
-
-	buf.WriteString(string(flusho))
-	buf.WriteString(" ")
-	buf.WriteString(collection)
-	buf.WriteString(" ")
-	buf.WriteString(bucket)
-	buf.WriteString(" ")
-	buf.WriteString(object)
-
-	err = conn.write(buf.String())
-	if err != nil {
+// result 发送命令并解析 RESULT NUMBER
+func (c *IngestClient) result(ctx context.Context, command *Command) (cnt int, err error) {
+	if _, err = command.Build(); err != nil {
 		return 0, err
 	}
 
-	// RESULT NUMBER
-	r, err := conn.read()
-	if err != nil {
-		return 0, err
-	}
+	err = c.pool.withRetry(ctx, false, func(conn *Conn) error {
+		// RESULT NUMBER
+		cnt, err = conn.resultOf(command)
+		return err
+	})
+	return cnt, err
+}
 
-	return strconv.Atoi(r[7:])
+// Handshake 返回服务端的握手信息, 可以据此判断支持的命令
+func (c *IngestClient) Handshake(ctx context.Context) (hs Handshake, err error) {
+	err = c.pool.withConn(ctx, func(conn *Conn) error {
+		hs = conn.Handshake()
+		return nil
+	})
+	return hs, err
 }
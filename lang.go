@@ -0,0 +1,51 @@
+package client
+
+import "fmt"
+
+// LangNone 关闭停用词过滤和分词的语言检测
+const LangNone = "none"
+
+// langs sonic 支持的 ISO 639-3 语言代码
+var langs = map[string]struct{}{
+	"afr": {}, "aka": {}, "amh": {}, "ara": {}, "aze": {}, "bel": {}, "ben": {}, "bul": {},
+	"cat": {}, "ces": {}, "cmn": {}, "dan": {}, "deu": {}, "ell": {}, "eng": {}, "epo": {},
+	"est": {}, "fin": {}, "fra": {}, "guj": {}, "heb": {}, "hin": {}, "hrv": {}, "hun": {},
+	"hye": {}, "ind": {}, "ita": {}, "jav": {}, "jpn": {}, "kan": {}, "kat": {}, "khm": {},
+	"kor": {}, "lat": {}, "lav": {}, "lit": {}, "mal": {}, "mar": {}, "mkd": {}, "mya": {},
+	"nep": {}, "nld": {}, "nob": {}, "ori": {}, "pan": {}, "pes": {}, "pol": {}, "por": {},
+	"ron": {}, "rus": {}, "sin": {}, "slk": {}, "slv": {}, "sna": {}, "spa": {}, "srp": {},
+	"swe": {}, "tam": {}, "tel": {}, "tgl": {}, "tha": {}, "tuk": {}, "tur": {}, "ukr": {},
+	"urd": {}, "uzb": {}, "vie": {}, "yid": {}, "zul": {},
+}
+
+// validLang 检查语言代码, 空字符串表示由 sonic 自动检测
+func validLang(lang string) error {
+	if lang == "" || lang == LangNone {
+		return nil
+	}
+	if _, ok := langs[lang]; !ok {
+		return fmt.Errorf("%w: unsupported language %q, want an ISO 639-3 code or %q", ErrInvalidArgument, lang, LangNone)
+	}
+	return nil
+}
+
+// CommandOption 单次调用的参数
+type CommandOption func(*commandOptions)
+
+type commandOptions struct {
+	lang string
+}
+
+// WithLang 指定 PUSH 或 QUERY 使用的语言, LangNone 表示关闭停用词和分词
+func WithLang(lang string) CommandOption {
+	return func(o *commandOptions) {
+		o.lang = lang
+	}
+}
+
+func newCommandOptions(opts []CommandOption) (o commandOptions, err error) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o, validLang(o.lang)
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidLang(t *testing.T) {
+	tests := []struct {
+		lang string
+		ok   bool
+	}{
+		{"", true},
+		{LangNone, true},
+		{"eng", true},
+		{"cmn", true},
+		{"en", false},
+		{"ENG", false},
+		{"xx", false},
+		{"eng)", false},
+	}
+	for _, tt := range tests {
+		err := validLang(tt.lang)
+		if tt.ok && err != nil {
+			t.Errorf("validLang(%q) = %v", tt.lang, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("validLang(%q) = %v, want ErrInvalidArgument", tt.lang, err)
+		}
+	}
+}
+
+func TestLangCommands(t *testing.T) {
+	tests := []struct {
+		cmd  *Command
+		want string
+	}{
+		{buildQuery("c", "b", "hi", 10, 0, ""), `QUERY c b "hi" LIMIT(10) OFFSET(0)`},
+		{buildQuery("c", "b", "hi", 10, 0, "eng"), `QUERY c b "hi" LIMIT(10) OFFSET(0) LANG(eng)`},
+		{buildQuery("c", "b", "hi", 10, 0, LangNone), `QUERY c b "hi" LIMIT(10) OFFSET(0) LANG(none)`},
+	}
+	for _, tt := range tests {
+		if got, err := tt.cmd.Build(); err != nil || got != tt.want {
+			t.Errorf("Build = %q, %v, want %q", got, err, tt.want)
+		}
+	}
+	if got, err := buildPush("c", "b", "o", "hi", "fra"); err != nil || got != `PUSH c b o "hi" LANG(fra)` {
+		t.Errorf("buildPush = %q, %v", got, err)
+	}
+}
+
+func TestLangRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	search := newTestSearch(t, s.Addr())
+	ctx := testCtx(t)
+
+	if err := ingest.Push(ctx, "c", "b", "o1", "bonjour", WithLang("fra")); err != nil {
+		t.Fatalf("Push with LANG: %v", err)
+	}
+	if err := ingest.Push(ctx, "c", "b", "o2", "bonjour", WithLang("fr")); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("Push with bad LANG = %v, want ErrInvalidArgument", err)
+	}
+	if got, err := search.Query(ctx, "c", "b", "bonjour", 10, 0, WithLang(LangNone)); err != nil || len(got) != 1 {
+		t.Fatalf("Query with LANG = %v, %v", got, err)
+	}
+	if _, err := search.Query(ctx, "c", "b", "bonjour", 10, 0, WithLang("zz")); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("Query with bad LANG = %v, want ErrInvalidArgument", err)
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBucket 结构体没有 sonic:"bucket" 字段时使用的 bucket
+const DefaultBucket = "default"
+
+// docLayout 一个结构体类型中各个 sonic 标签对应的字段下标
+type docLayout struct {
+	object int
+	bucket int // -1 表示没有
+	lang   int // -1 表示没有
+	text   []int
+}
+
+// layouts 按类型缓存反射结果, reflect.Type -> *docLayout
+var layouts sync.Map
+
+// layoutOf 解析结构体的 sonic 标签
+//
+//	type Article struct {
+//		ID    int64  `sonic:"object"`
+//		Tenant string `sonic:"bucket"`
+//		Title string `sonic:"text"`
+//		Body  string `sonic:"text"`
+//		Lang  string `sonic:"lang"`
+//	}
+func layoutOf(t reflect.Type) (*docLayout, error) {
+	if l, ok := layouts.Load(t); ok {
+		return l.(*docLayout), nil
+	}
+
+	l := &docLayout{object: -1, bucket: -1, lang: -1}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("sonic")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if f.PkgPath != "" {
+			return nil, fmt.Errorf("sonic: field %s.%s is unexported", t, f.Name)
+		}
+
+		switch tag {
+		case "object":
+			if l.object >= 0 {
+				return nil, fmt.Errorf("sonic: %s has more than one object field", t)
+			}
+			if !isIdentKind(f.Type.Kind()) {
+				return nil, fmt.Errorf("sonic: object field %s.%s must be a string or an integer", t, f.Name)
+			}
+			l.object = i
+		case "bucket", "lang":
+			if f.Type.Kind() != reflect.String {
+				return nil, fmt.Errorf("sonic: %s field %s.%s must be a string", tag, t, f.Name)
+			}
+			if tag == "bucket" {
+				l.bucket = i
+			} else {
+				l.lang = i
+			}
+		case "text":
+			k := f.Type.Kind()
+			if k != reflect.String && !(k == reflect.Slice && f.Type.Elem().Kind() == reflect.String) {
+				return nil, fmt.Errorf("sonic: text field %s.%s must be a string or []string", t, f.Name)
+			}
+			l.text = append(l.text, i)
+		default:
+			return nil, fmt.Errorf("sonic: unknown tag %q on %s.%s", tag, t, f.Name)
+		}
+	}
+
+	if l.object < 0 {
+		return nil, fmt.Errorf("sonic: %s has no field tagged sonic:\"object\"", t)
+	}
+
+	actual, _ := layouts.LoadOrStore(t, l)
+	return actual.(*docLayout), nil
+}
+
+func isIdentKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// toDocument 按标签把结构体转换成 Document, v 可以是结构体或结构体指针
+func toDocument(collection string, v interface{}) (Document, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return Document{}, fmt.Errorf("sonic: cannot map nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return Document{}, fmt.Errorf("sonic: cannot map %T, want a struct", v)
+	}
+
+	l, err := layoutOf(rv.Type())
+	if err != nil {
+		return Document{}, err
+	}
+
+	doc := Document{Collection: collection, Bucket: DefaultBucket}
+
+	switch f := rv.Field(l.object); f.Kind() {
+	case reflect.String:
+		doc.Object = f.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		doc.Object = strconv.FormatInt(f.Int(), 10)
+	default:
+		doc.Object = strconv.FormatUint(f.Uint(), 10)
+	}
+
+	if l.bucket >= 0 {
+		if b := rv.Field(l.bucket).String(); b != "" {
+			doc.Bucket = b
+		}
+	}
+	if l.lang >= 0 {
+		doc.Lang = rv.Field(l.lang).String()
+	}
+
+	var texts []string
+	for _, i := range l.text {
+		f := rv.Field(i)
+		if f.Kind() == reflect.String {
+			texts = append(texts, f.String())
+			continue
+		}
+		for j := 0; j < f.Len(); j++ {
+			texts = append(texts, f.Index(j).String())
+		}
+	}
+	doc.Text = strings.Join(texts, " ")
+
+	return doc, nil
+}
+
+// Index 按 sonic 标签把结构体写入索引
+func (c *IngestClient) Index(ctx context.Context, collection string, v interface{}) error {
+	doc, err := toDocument(collection, v)
+	if err != nil {
+		return err
+	}
+	var opts []CommandOption
+	if doc.Lang != "" {
+		opts = append(opts, WithLang(doc.Lang))
+	}
+	return c.Push(ctx, doc.Collection, doc.Bucket, doc.Object, doc.Text, opts...)
+}
+
+// Remove 按 sonic 标签把结构体从索引中删除
+func (c *IngestClient) Remove(ctx context.Context, collection string, v interface{}) error {
+	doc, err := toDocument(collection, v)
+	if err != nil {
+		return err
+	}
+	_, err = c.FlushO(ctx, doc.Collection, doc.Bucket, doc.Object)
+	return err
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testArticle struct {
+	ID     int64    `sonic:"object"`
+	Tenant string   `sonic:"bucket"`
+	Title  string   `sonic:"text"`
+	Tags   []string `sonic:"text"`
+	Lang   string   `sonic:"lang"`
+	Views  int
+}
+
+type testNote struct {
+	Key  uint8  `sonic:"object"`
+	Body string `sonic:"text"`
+}
+
+func TestToDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want Document
+	}{
+		{
+			"struct",
+			testArticle{ID: 42, Tenant: "acme", Title: "Hello", Tags: []string{"go", "sonic"}, Lang: "eng"},
+			Document{Collection: "c", Bucket: "acme", Object: "42", Text: "Hello go sonic", Lang: "eng"},
+		},
+		{
+			"pointer with default bucket",
+			&testArticle{ID: -1, Title: "Hi"},
+			Document{Collection: "c", Bucket: DefaultBucket, Object: "-1", Text: "Hi"},
+		},
+		{
+			"unsigned object",
+			testNote{Key: 7, Body: "note"},
+			Document{Collection: "c", Bucket: DefaultBucket, Object: "7", Text: "note"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := toDocument("c", tt.v)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: toDocument = %+v, %v, want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestToDocumentErrors(t *testing.T) {
+	var nilArticle *testArticle
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"not a struct", "hello"},
+		{"nil pointer", nilArticle},
+		{"no object field", struct {
+			Body string `sonic:"text"`
+		}{}},
+		{"two object fields", struct {
+			A string `sonic:"object"`
+			B string `sonic:"object"`
+		}{}},
+		{"float object", struct {
+			ID float64 `sonic:"object"`
+		}{}},
+		{"int bucket", struct {
+			ID     string `sonic:"object"`
+			Bucket int    `sonic:"bucket"`
+		}{}},
+		{"int text", struct {
+			ID   string `sonic:"object"`
+			Text int    `sonic:"text"`
+		}{}},
+		{"unknown tag", struct {
+			ID string `sonic:"object"`
+			X  string `sonic:"title"`
+		}{}},
+		{"unexported field", struct {
+			ID   string `sonic:"object"`
+			text string `sonic:"text"`
+		}{}},
+	}
+	for _, tt := range tests {
+		if _, err := toDocument("c", tt.v); err == nil {
+			t.Errorf("%s: toDocument returned nil error", tt.name)
+		}
+	}
+}
+
+func TestIndexRemove(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	search := newTestSearch(t, s.Addr())
+	ctx := testCtx(t)
+
+	a := &testArticle{ID: 1, Tenant: "acme", Title: "Sonic search", Tags: []string{"fast"}, Lang: "eng"}
+	if err := ingest.Index(ctx, "articles", a); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if got, err := search.Query(ctx, "articles", "acme", "fast", 10, 0); err != nil || !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("Query = %v, %v", got, err)
+	}
+
+	if err := ingest.Remove(ctx, "articles", a); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if got, err := search.Query(ctx, "articles", "acme", "fast", 10, 0); err != nil || len(got) != 0 {
+		t.Fatalf("Query after Remove = %v, %v", got, err)
+	}
+
+	if err := ingest.Index(ctx, "articles", &testArticle{ID: 2, Title: "x", Lang: "xx"}); err == nil {
+		t.Fatal("Index with an unsupported lang returned nil error")
+	}
+}
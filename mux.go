@@ -0,0 +1,313 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// muxResult 一次搜索的结果
+type muxResult struct {
+	results []string
+	err     error
+}
+
+// muxCall 等待 EVENT 的调用方
+type muxCall struct {
+	eventType searchCommands
+	ch        chan muxResult
+}
+
+// muxConn 多路复用的搜索链接
+// 多个 goroutine 可以同时在一个链接上发送命令, 由读协程按事件 ID 分发 EVENT
+type muxConn struct {
+	cn *Conn
+
+	readTimeout  time.Duration // 等待 EVENT 的最长时间
+	writeTimeout time.Duration
+
+	mu      sync.Mutex
+	pending []*muxCall          // 已发送, 等待 PENDING 的调用, 按发送顺序排列
+	events  map[string]*muxCall // 已收到 PENDING, 等待 EVENT 的调用
+	err     error
+}
+
+func newMuxConn(cn *Conn, readTimeout, writeTimeout time.Duration) *muxConn {
+	m := &muxConn{
+		cn:           cn,
+		readTimeout:  readTimeout,
+		writeTimeout: writeTimeout,
+		events:       make(map[string]*muxCall),
+	}
+	go m.loop()
+	return m
+}
+
+// do 发送一条搜索命令并等待对应的 EVENT
+func (m *muxConn) do(ctx context.Context, cmd string, eventType searchCommands) ([]string, error) {
+	call := &muxCall{
+		eventType: eventType,
+		ch:        make(chan muxResult, 1),
+	}
+
+	// 写入和入队需要在同一把锁下, 保证队列顺序和发送顺序一致
+	m.mu.Lock()
+	if m.err != nil {
+		err := m.err
+		m.mu.Unlock()
+		return nil, err
+	}
+	m.pending = append(m.pending, call)
+	err := m.cn.netConn.SetWriteDeadline(deadline(ctx, time.Now(), m.writeTimeout))
+	if err == nil {
+		err = m.cn.write(cmd)
+	}
+	if err != nil {
+		m.failLocked(err)
+		m.mu.Unlock()
+		return nil, err
+	}
+	m.mu.Unlock()
+
+	// 读协程被所有调用共用, 不能设置读截止时间, 只能在这里限制等待的时间
+	parent := ctx
+	if m.readTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.readTimeout)
+		defer cancel()
+	}
+
+	// 取消后结果会被丢进带缓冲的 channel 里, 读协程不会阻塞
+	select {
+	case <-ctx.Done():
+		// 读超时说明服务端在这条链接上没有回复, 标记为断开, get 会重新拨号
+		// 调用方自己的 ctx 结束不影响其他调用, 链接继续使用
+		if parent.Err() == nil {
+			m.fail(ctx.Err())
+		}
+		return nil, ctx.Err()
+	case r := <-call.ch:
+		return r.results, r.err
+	}
+}
+
+// loop 读协程, 负责把 PENDING 和 EVENT 分发给调用方
+func (m *muxConn) loop() {
+	for {
+		line, err := m.cn.readLine()
+		if err != nil {
+			if !isBadConn(err) {
+				// ERR 代替 PENDING 返回给队首的调用
+				m.mu.Lock()
+				call := m.popPending()
+				m.mu.Unlock()
+				if call != nil {
+					call.ch <- muxResult{err: err}
+				}
+				continue
+			}
+			m.fail(err)
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PENDING":
+			m.mu.Lock()
+			call := m.popPending()
+			if call != nil {
+				m.events[fields[1]] = call
+			}
+			m.mu.Unlock()
+		case "EVENT":
+			if len(fields) < 3 {
+				continue
+			}
+			m.mu.Lock()
+			call := m.events[fields[2]]
+			delete(m.events, fields[2])
+			m.mu.Unlock()
+			if call != nil {
+				call.ch <- muxResult{results: getSearchResults(line, string(call.eventType))}
+			}
+		}
+	}
+}
+
+func (m *muxConn) popPending() *muxCall {
+	if len(m.pending) == 0 {
+		return nil
+	}
+	call := m.pending[0]
+	m.pending = m.pending[1:]
+	return call
+}
+
+func (m *muxConn) fail(err error) {
+	m.mu.Lock()
+	m.failLocked(err)
+	m.mu.Unlock()
+}
+
+// failLocked 链接出错, 通知所有等待中的调用并关闭链接
+func (m *muxConn) failLocked(err error) {
+	if m.err != nil {
+		return
+	}
+	m.err = err
+	for _, call := range m.pending {
+		call.ch <- muxResult{err: err}
+	}
+	for _, call := range m.events {
+		call.ch <- muxResult{err: err}
+	}
+	m.pending = nil
+	m.events = nil
+	// 只关闭底层链接, 读协程会随之退出
+	_ = m.cn.netConn.Close()
+}
+
+func (m *muxConn) broken() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err != nil
+}
+
+func (m *muxConn) close() {
+	m.fail(ErrClosed)
+}
+
+// SearchMux 多路复用的搜索客户端, 用少量链接承载大量并发搜索
+type SearchMux struct {
+	opt     Options
+	breaker *breaker
+
+	mu      sync.Mutex
+	conns   []*muxConn
+	dialing []chan struct{} // 正在拨号的槽位, 拨号结束时关闭
+	next    uint32          // atomic
+	closed  bool
+}
+
+// NewSearchMux 创建最多 size 个链接的多路复用客户端, 链接在第一次使用时建立
+// opts 中的 Dialer、读写超时和熔断器配置同样适用, 连接池相关的配置会被忽略
+func NewSearchMux(endpoint, password string, size int, opts ...Option) *SearchMux {
+	if size <= 0 {
+		size = 1
+	}
+	opt := connectOptions(endpoint, password, Search, applyOptions(defaultOptions(), opts))
+	return &SearchMux{
+		opt:     opt,
+		breaker: newBreaker(opt.Breaker, size),
+		conns:   make([]*muxConn, size),
+		dialing: make([]chan struct{}, size),
+	}
+}
+
+// get 轮询取出一个链接, 断开的链接会被重新建立
+// 同一个槽位同时只有一个调用方拨号, 其他调用方等待拨号结束或自己的 ctx 结束
+func (s *SearchMux) get(ctx context.Context) (*muxConn, error) {
+	idx := int(atomic.AddUint32(&s.next, 1) % uint32(len(s.conns)))
+
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if m := s.conns[idx]; m != nil && !m.broken() {
+			s.mu.Unlock()
+			return m, nil
+		}
+		ch := s.dialing[idx]
+		if ch == nil {
+			break
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	ch := make(chan struct{})
+	s.dialing[idx] = ch
+	s.mu.Unlock()
+
+	// 在锁外拨号, 一个卡住的实例不会阻塞使用其他链接的调用方
+	cn, err := dial(ctx, &s.opt, s.breaker)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dialing[idx] = nil
+	close(ch)
+
+	if err != nil {
+		return nil, err
+	}
+	if s.closed {
+		_ = cn.Close()
+		return nil, ErrClosed
+	}
+
+	m := newMuxConn(cn, s.opt.ReadTimeout, s.opt.WriteTimeout)
+	s.conns[idx] = m
+	return m, nil
+}
+
+func (s *SearchMux) search(ctx context.Context, command *Command, eventType searchCommands) ([]string, error) {
+	cmd, err := command.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.do(ctx, cmd, eventType)
+}
+
+// Query ...
+func (s *SearchMux) Query(ctx context.Context, collection, bucket, term string, limit, offset int, opts ...CommandOption) (results []string, err error) {
+	o, err := newCommandOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.search(ctx, buildQuery(collection, bucket, term, limit, offset, o.lang), query)
+}
+
+// Suggest ...
+func (s *SearchMux) Suggest(ctx context.Context, collection, bucket, word string, limit int) (results []string, err error) {
+	return s.search(ctx, buildSuggest(collection, bucket, word, limit), suggest)
+}
+
+// List ...
+func (s *SearchMux) List(ctx context.Context, collection, bucket string, limit, offset int) (results []string, err error) {
+	return s.search(ctx, buildList(collection, bucket, limit, offset), list)
+}
+
+// Close 关闭所有链接
+func (s *SearchMux) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	s.closed = true
+	for _, m := range s.conns {
+		if m != nil {
+			m.close()
+		}
+	}
+	return nil
+}
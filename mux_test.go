@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSearchMux(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	for i := 0; i < 5; i++ {
+		if err := ingest.Push(ctx, "c", fmt.Sprint("b", i), "o", "hello"); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+
+	var dials int32
+	mux := NewSearchMux(s.Addr(), "secret", 2, WithDialer(func(ctx context.Context) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", s.Addr())
+	}))
+	defer mux.Close()
+
+	// 并发的查询共享两条链接, 每个调用方拿到自己的结果
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bucket := fmt.Sprint("b", i%5)
+			got, err := mux.Query(ctx, "c", bucket, "hello", 10, 0)
+			if err == nil && (len(got) != 1 || got[0] != "o") {
+				err = fmt.Errorf("Query %s = %v, want [o]", bucket, got)
+			}
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Errorf("dials = %d, want one per slot", n)
+	}
+
+	if got, err := mux.Suggest(ctx, "c", "b0", "hel", 5); err != nil || len(got) != 1 {
+		t.Fatalf("Suggest = %v, %v, want [hello]", got, err)
+	}
+	if got, err := mux.List(ctx, "c", "b0", 10, 0); err != nil || len(got) != 1 {
+		t.Fatalf("List = %v, %v, want [hello]", got, err)
+	}
+
+	if err := mux.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := mux.Query(ctx, "c", "b0", "hello", 10, 0); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Query after Close = %v, want ErrClosed", err)
+	}
+}
+
+// 拨号卡住时由调用方的 ctx 结束, 不会阻塞其他链接上的调用
+func TestSearchMuxDialUsesCallerContext(t *testing.T) {
+	s := newTestServer(t)
+	ctx := testCtx(t)
+
+	var slow int32 = 1
+	mux := NewSearchMux(s.Addr(), "secret", 2, WithDialer(func(ctx context.Context) (net.Conn, error) {
+		if atomic.CompareAndSwapInt32(&slow, 1, 0) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", s.Addr())
+	}))
+	defer mux.Close()
+
+	stuck, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := mux.Query(stuck, "c", "b", "hello", 10, 0)
+		done <- err
+	}()
+
+	// 等第一个调用进入拨号
+	for atomic.LoadInt32(&slow) == 1 {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	if _, err := mux.Query(ctx, "c", "b", "hello", 10, 0); err != nil {
+		t.Fatalf("Query on the other slot: %v", err)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Fatalf("Query on the other slot waited %s for the stuck dial", d)
+	}
+
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Query with stuck dial = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// 读超时后槽位会重新拨号, 不会一直使用没有回复的链接
+func TestSearchMuxRecoversFromHungReply(t *testing.T) {
+	s := newTestServer(t)
+	ctx := testCtx(t)
+
+	var dials int32
+	mux := NewSearchMux(s.Addr(), "secret", 1, WithReadTimeout(200*time.Millisecond), WithDialer(func(ctx context.Context) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", s.Addr())
+	}))
+	defer mux.Close()
+
+	if _, err := mux.Query(ctx, "c", "b", "hello", 10, 0); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	// 链接上的回复卡住, 超过读超时
+	s.Conns("search").SetDelay(time.Second)
+	if _, err := mux.Query(ctx, "c", "b", "hello", 10, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Query with hung reply = %v, want context.DeadlineExceeded", err)
+	}
+	s.ResetFaults()
+
+	if _, err := mux.Query(ctx, "c", "b", "hello", 10, 0); err != nil {
+		t.Fatalf("Query after hung reply: %v", err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("dials = %d, want the slot redialed once", n)
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+)
+
+// Logger 连接池输出日志使用的接口, *log.Logger 满足该接口
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option 修改连接池配置
+type Option func(*Options)
+
+// WithPoolSize 设置连接池大小
+func WithPoolSize(n int) Option {
+	return func(opt *Options) {
+		opt.PoolSize = n
+	}
+}
+
+// WithMinIdle 设置最小空闲链接数
+func WithMinIdle(n int) Option {
+	return func(opt *Options) {
+		opt.MinIdleConns = n
+		opt.minIdleSet = true
+	}
+}
+
+// WithMaxConnAge 设置链接的最大寿命, 0 表示不限制
+func WithMaxConnAge(d time.Duration) Option {
+	return func(opt *Options) {
+		opt.MaxConnAge = d
+	}
+}
+
+// WithPoolTimeout 设置从连接池获取链接的等待时间
+func WithPoolTimeout(d time.Duration) Option {
+	return func(opt *Options) {
+		opt.PoolTimeout = d
+	}
+}
+
+// WithIdleTimeout 设置链接空闲时间, 0 表示不淘汰空闲链接
+func WithIdleTimeout(d time.Duration) Option {
+	return func(opt *Options) {
+		opt.IdleTimeout = d
+	}
+}
+
+// WithReadTimeout 设置每次调用读取的超时时间
+func WithReadTimeout(d time.Duration) Option {
+	return func(opt *Options) {
+		opt.ReadTimeout = d
+	}
+}
+
+// WithWriteTimeout 设置每次调用写入的超时时间
+func WithWriteTimeout(d time.Duration) Option {
+	return func(opt *Options) {
+		opt.WriteTimeout = d
+	}
+}
+
+// WithDialer 设置发起网络连接的函数
+func WithDialer(dialer func(context.Context) (net.Conn, error)) Option {
+	return func(opt *Options) {
+		opt.Dialer = dialer
+	}
+}
+
+// WithOnClose 设置关闭链接时执行的操作
+func WithOnClose(fn func(*Conn) error) Option {
+	return func(opt *Options) {
+		opt.OnClose = fn
+	}
+}
+
+// WithRetry 设置命令失败后的重试策略
+func WithRetry(rp RetryPolicy) Option {
+	return func(opt *Options) {
+		opt.Retry = &rp
+	}
+}
+
+// WithBreaker 设置拨号熔断器
+func WithBreaker(cfg BreakerConfig) Option {
+	return func(opt *Options) {
+		opt.Breaker = cfg
+	}
+}
+
+// WithLogger 设置连接池的日志输出
+func WithLogger(logger Logger) Option {
+	return func(opt *Options) {
+		opt.Logger = logger
+	}
+}
+
+// applyOptions 依次应用 opts, 调用方没有设置最小空闲链接数时, 默认值不超过连接池大小
+func applyOptions(opt Options, opts []Option) Options {
+	for _, o := range opts {
+		o(&opt)
+	}
+	if !opt.minIdleSet && opt.MinIdleConns > opt.PoolSize {
+		opt.MinIdleConns = opt.PoolSize
+	}
+	return opt
+}
+
+// validate 检查配置, PoolSize 小于等于 0 时连接池会死锁
+func (opt *Options) validate() error {
+	if opt.PoolSize <= 0 {
+		return errors.New("sonic: pool size must be greater than 0")
+	}
+	if opt.MinIdleConns < 0 {
+		return errors.New("sonic: min idle conns must not be negative")
+	}
+	if opt.MinIdleConns > opt.PoolSize {
+		return errors.New("sonic: min idle conns must not exceed pool size")
+	}
+	if opt.PoolTimeout <= 0 {
+		return errors.New("sonic: pool timeout must be greater than 0")
+	}
+	if opt.MaxConnAge < 0 || opt.IdleTimeout < 0 || opt.IdleCheckFrequency < 0 {
+		return errors.New("sonic: durations must not be negative")
+	}
+	if opt.ReadTimeout < 0 || opt.WriteTimeout < 0 {
+		return errors.New("sonic: timeouts must not be negative")
+	}
+	if opt.Breaker.FailureThreshold < 0 || opt.Breaker.CoolDown < 0 || opt.Breaker.HalfOpenProbes < 0 {
+		return errors.New("sonic: breaker settings must not be negative")
+	}
+	if opt.Retry != nil && (opt.Retry.Jitter < 0 || opt.Retry.Jitter > 1) {
+		return errors.New("sonic: retry jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+var defaultLogger Logger = log.New(log.Writer(), "sonic: ", log.LstdFlags)
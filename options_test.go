@@ -0,0 +1,114 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	s := newTestServer(t)
+
+	constructors := map[string]func(opts ...Option) (*ConnPool, error){
+		"NewIngestClient": func(opts ...Option) (*ConnPool, error) {
+			c, err := NewIngestClient(s.Addr(), "secret", opts...)
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { _ = c.Close() })
+			return c.pool, nil
+		},
+		"NewSearchClient": func(opts ...Option) (*ConnPool, error) {
+			c, err := NewSearchClient(s.Addr(), "secret", opts...)
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { _ = c.Close() })
+			return c.pool, nil
+		},
+		"NewControlClient": func(opts ...Option) (*ConnPool, error) {
+			c, err := NewControlClient(s.Addr(), "secret", opts...)
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { _ = c.Close() })
+			return c.pool, nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+		minIdle int // 只检查 ingest 和 search, control 有自己的默认值
+	}{
+		{"defaults", nil, false, 10},
+		{"small pool with default min idle", []Option{WithPoolSize(5)}, false, 5},
+		{"small pool with min idle", []Option{WithPoolSize(5), WithMinIdle(2)}, false, 2},
+		{"zero pool size", []Option{WithPoolSize(0)}, true, 0},
+		{"negative pool size", []Option{WithPoolSize(-1)}, true, 0},
+		{"min idle over pool size", []Option{WithPoolSize(5), WithMinIdle(6)}, true, 0},
+		{"min idle set before pool size", []Option{WithMinIdle(6), WithPoolSize(5)}, true, 0},
+		{"negative min idle", []Option{WithMinIdle(-1)}, true, 0},
+		{"zero pool timeout", []Option{WithPoolTimeout(0)}, true, 0},
+		{"negative read timeout", []Option{WithReadTimeout(-time.Second)}, true, 0},
+		{"negative write timeout", []Option{WithWriteTimeout(-time.Second)}, true, 0},
+		{"negative idle timeout", []Option{WithIdleTimeout(-time.Second)}, true, 0},
+	}
+	for name, newPool := range constructors {
+		for _, tt := range tests {
+			p, err := newPool(append([]Option{quiet}, tt.opts...)...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%s %s returned nil error", name, tt.name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %s: %v", name, tt.name, err)
+				continue
+			}
+			if name != "NewControlClient" && p.opt.MinIdleConns != tt.minIdle {
+				t.Errorf("%s %s MinIdleConns = %d, want %d", name, tt.name, p.opt.MinIdleConns, tt.minIdle)
+			}
+		}
+	}
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	s := newTestServer(t)
+	ctx := testCtx(t)
+
+	tests := []struct {
+		query   string
+		opts    []Option
+		wantErr bool
+		minIdle int
+	}{
+		{"?pool_size=5", nil, false, 5},
+		{"?pool_size=5&min_idle=2", nil, false, 2},
+		{"", []Option{WithPoolSize(5)}, false, 5},
+		{"?pool_size=5&min_idle=6", nil, true, 0},
+		{"?pool_size=0", nil, true, 0},
+		{"?read_timeout=-1s", nil, true, 0},
+		{"", []Option{WithPoolSize(0)}, true, 0},
+		{"?min_idle=6", []Option{WithPoolSize(5)}, true, 0},
+	}
+	for _, tt := range tests {
+		c, err := New(ctx, s.DSN()+tt.query, append([]Option{quiet}, tt.opts...)...)
+		if tt.wantErr {
+			if err == nil {
+				_ = c.Close()
+				t.Errorf("New(%q) returned nil error", tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(%q): %v", tt.query, err)
+			continue
+		}
+		if n := c.search.pool.opt.MinIdleConns; n != tt.minIdle {
+			t.Errorf("New(%q) MinIdleConns = %d, want %d", tt.query, n, tt.minIdle)
+		}
+		_ = c.Close()
+	}
+}
@@ -0,0 +1,441 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrOutboxClosed 向已关闭的 Outbox 写入
+var ErrOutboxClosed = errors.New("sonic: outbox is closed")
+
+// ErrOutboxBroken 追加失败后日志末尾无法恢复, 需要重新打开 Outbox
+var ErrOutboxBroken = errors.New("sonic: outbox log is broken")
+
+// OutboxOptions Outbox 的配置, 零值使用默认配置
+type OutboxOptions struct {
+	RetryInterval    time.Duration // 发送失败后的重试间隔, 默认 1s
+	OpTimeout        time.Duration // 每个操作的超时时间, 默认 5s
+	CompactThreshold int           // 日志中已确认的记录达到多少条时压缩, 默认 1000
+}
+
+// outboxEntry 日志中的一行, Ack 不为 0 时表示 Seq 小于等于 Ack 的操作都已送达
+type outboxEntry struct {
+	Seq        uint64          `json:"seq,omitempty"`
+	Op         ingesteCommands `json:"op,omitempty"`
+	Collection string          `json:"collection,omitempty"`
+	Bucket     string          `json:"bucket,omitempty"`
+	Object     string          `json:"object,omitempty"`
+	Text       string          `json:"text,omitempty"`
+	Lang       string          `json:"lang,omitempty"`
+	Ack        uint64          `json:"ack,omitempty"`
+}
+
+// Outbox 持久化的写入队列
+// 操作先追加到本地日志并 fsync, 再由后台协程按顺序发送给 sonic, 至少送达一次
+// 进程重启后重新打开同一个日志文件会继续发送未确认的操作
+type Outbox struct {
+	client *IngestClient
+	path   string
+	opt    OutboxOptions
+
+	mu      sync.Mutex
+	f       *os.File
+	pending []outboxEntry
+	seq     uint64
+	acked   int   // 日志中已确认的记录数
+	broken  error // 追加失败且无法截断时记录原因, 之后的追加都返回该错误
+	closed  bool
+
+	notify chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewOutbox 打开或创建 path 处的日志, 并开始发送其中未确认的操作
+func NewOutbox(client *IngestClient, path string, opt OutboxOptions) (*Outbox, error) {
+	if opt.RetryInterval <= 0 {
+		opt.RetryInterval = time.Second
+	}
+	if opt.OpTimeout <= 0 {
+		opt.OpTimeout = time.Second * 5
+	}
+	if opt.CompactThreshold <= 0 {
+		opt.CompactThreshold = 1000
+	}
+
+	o := &Outbox{
+		client: client,
+		path:   path,
+		opt:    opt,
+		notify: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	// 启动时压缩一次, 去掉上次运行留下的已确认记录
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+
+	go o.run()
+	o.wake()
+	return o, nil
+}
+
+// load 读取日志, 最后一行不完整时忽略, 中间的行无法解析时返回错误
+func (o *Outbox) load() error {
+	f, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []outboxEntry
+	var ack uint64
+	var badLine int
+	var badErr error
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		// 不完整的行只可能是最后一行, 后面还有记录说明日志已经损坏
+		if badErr != nil {
+			return fmt.Errorf("sonic: outbox log %s line %d: %v", o.path, badLine, badErr)
+		}
+		var e outboxEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			badLine, badErr = line, err
+			continue
+		}
+		if e.Ack > ack {
+			ack = e.Ack
+		}
+		if e.Seq > 0 {
+			entries = append(entries, e)
+		}
+		if e.Seq > o.seq {
+			o.seq = e.Seq
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Seq > ack {
+			o.pending = append(o.pending, e)
+		}
+	}
+	return nil
+}
+
+// compact 只保留未确认的操作重写日志, 写入临时文件后再替换
+func (o *Outbox) compact() error {
+	tmp := o.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range o.pending {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if o.f != nil {
+		_ = o.f.Close()
+		o.f = nil
+	}
+	if err = os.Rename(tmp, o.path); err != nil {
+		return err
+	}
+	if d, err := os.Open(filepath.Dir(o.path)); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	o.f, err = os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0644)
+	o.acked = 0
+	if err == nil {
+		// 日志已经按 pending 重写, 之前追加失败留下的半行也被去掉了
+		o.broken = nil
+	}
+	return err
+}
+
+// appendLocked 追加一行并 fsync
+// 写入或 fsync 失败时截断到写入前的长度, 以免下一行接在半行后面, 重新打开时被当作损坏的记录
+// 截断也失败时不再接受新的记录, 直到下次压缩重写日志
+func (o *Outbox) appendLocked(e outboxEntry) error {
+	if o.broken != nil {
+		return o.broken
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	fi, err := o.f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = o.f.Write(append(b, '\n')); err == nil {
+		err = o.f.Sync()
+	}
+	if err != nil {
+		if terr := o.f.Truncate(fi.Size()); terr != nil {
+			o.broken = fmt.Errorf("%w: %v", ErrOutboxBroken, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (o *Outbox) enqueue(e outboxEntry) error {
+	// 写入日志之前先构造一遍命令, 不合法的操作直接返回给调用方, 不会在后台被丢弃
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return ErrOutboxClosed
+	}
+
+	e.Seq = o.seq + 1
+	if err := o.appendLocked(e); err != nil {
+		return err
+	}
+	o.seq = e.Seq
+	o.pending = append(o.pending, e)
+	o.wake()
+	return nil
+}
+
+// validate 检查操作能否构造出合法的命令
+func (e outboxEntry) validate() error {
+	var cmd *Command
+	switch e.Op {
+	case push:
+		_, err := buildPush(e.Collection, e.Bucket, e.Object, e.Text, e.Lang)
+		return err
+	case pop:
+		cmd = NewCommand(string(pop)).Ident(e.Collection).Ident(e.Bucket).Ident(e.Object).Text(e.Text)
+	case flushc:
+		cmd = NewCommand(string(flushc)).Ident(e.Collection)
+	case flushb:
+		cmd = NewCommand(string(flushb)).Ident(e.Collection).Ident(e.Bucket)
+	case flusho:
+		cmd = NewCommand(string(flusho)).Ident(e.Collection).Ident(e.Bucket).Ident(e.Object)
+	}
+	_, err := cmd.Build()
+	return err
+}
+
+func (o *Outbox) wake() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Push 把 PUSH 写入日志, 返回时已经持久化, 但还没有送达 sonic
+func (o *Outbox) Push(collection, bucket, object, text string, opts ...CommandOption) error {
+	co, err := newCommandOptions(opts)
+	if err != nil {
+		return err
+	}
+	return o.enqueue(outboxEntry{Op: push, Collection: collection, Bucket: bucket, Object: object, Text: text, Lang: co.lang})
+}
+
+// Pop 把 POP 写入日志
+func (o *Outbox) Pop(collection, bucket, object, text string) error {
+	return o.enqueue(outboxEntry{Op: pop, Collection: collection, Bucket: bucket, Object: object, Text: text})
+}
+
+// FlushC 把 FLUSHC 写入日志
+func (o *Outbox) FlushC(collection string) error {
+	return o.enqueue(outboxEntry{Op: flushc, Collection: collection})
+}
+
+// FlushB 把 FLUSHB 写入日志
+func (o *Outbox) FlushB(collection, bucket string) error {
+	return o.enqueue(outboxEntry{Op: flushb, Collection: collection, Bucket: bucket})
+}
+
+// FlushO 把 FLUSHO 写入日志
+func (o *Outbox) FlushO(collection, bucket, object string) error {
+	return o.enqueue(outboxEntry{Op: flusho, Collection: collection, Bucket: bucket, Object: object})
+}
+
+// Pending 还没有送达的操作数
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Flush 等待当前所有操作送达, ctx 结束时返回
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.mu.Lock()
+	target := o.seq
+	o.mu.Unlock()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		o.mu.Lock()
+		drained := len(o.pending) == 0 || o.pending[0].Seq > target
+		o.mu.Unlock()
+		if drained {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close 停止发送并关闭日志, 未送达的操作会在下次打开时继续发送
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return ErrOutboxClosed
+	}
+	o.closed = true
+	o.mu.Unlock()
+
+	close(o.stop)
+	<-o.done
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.f.Close()
+}
+
+// run 按顺序发送队首的操作, 失败时等待 RetryInterval 后重试
+func (o *Outbox) run() {
+	defer close(o.done)
+
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-o.notify:
+		}
+
+		for {
+			o.mu.Lock()
+			if len(o.pending) == 0 {
+				o.mu.Unlock()
+				break
+			}
+			e := o.pending[0]
+			o.mu.Unlock()
+
+			err := o.send(e)
+			if err != nil && outboxRetryable(err) {
+				o.client.pool.logf("outbox: %s seq %d failed, will retry: %s", e.Op, e.Seq, err)
+				select {
+				case <-o.stop:
+					return
+				case <-time.After(o.opt.RetryInterval):
+				}
+				continue
+			}
+			if err != nil {
+				// 命令本身不合法, 重试也不会成功, 丢弃以免阻塞后面的操作
+				o.client.pool.logf("outbox: dropping %s seq %d: %s", e.Op, e.Seq, err)
+			}
+
+			if err = o.ack(e.Seq); err != nil {
+				o.client.pool.logf("outbox: ack seq %d failed: %s", e.Seq, err)
+			}
+		}
+	}
+}
+
+func (o *Outbox) send(e outboxEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), o.opt.OpTimeout)
+	defer cancel()
+
+	var err error
+	switch e.Op {
+	case push:
+		var opts []CommandOption
+		if e.Lang != "" {
+			opts = append(opts, WithLang(e.Lang))
+		}
+		err = o.client.Push(ctx, e.Collection, e.Bucket, e.Object, e.Text, opts...)
+	case pop:
+		err = o.client.Pop(ctx, e.Collection, e.Bucket, e.Object, e.Text)
+	case flushc:
+		_, err = o.client.FlushC(ctx, e.Collection)
+	case flushb:
+		_, err = o.client.FlushB(ctx, e.Collection, e.Bucket)
+	case flusho:
+		_, err = o.client.FlushO(ctx, e.Collection, e.Bucket, e.Object)
+	}
+	return err
+}
+
+// ack 记录 seq 之前的操作已经送达, 已确认的记录达到 CompactThreshold 时压缩日志
+// 压缩需要重写文件并 fsync 两次, 平时只追加一条确认记录
+func (o *Outbox) ack(seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.pending = o.pending[1:]
+	o.acked++
+
+	if o.acked >= o.opt.CompactThreshold {
+		return o.compact()
+	}
+	return o.appendLocked(outboxEntry{Ack: seq})
+}
+
+// outboxRetryable 链接、拨号、超时等错误可能是暂时的, 需要重试
+// 服务端拒绝的命令重试也不会成功, 只有认证失败和服务器关闭时才重试
+func outboxRetryable(err error) bool {
+	if errors.Is(err, ErrInvalidIdent) || errors.Is(err, ErrInvalidArgument) {
+		return false
+	}
+	var se *ServerError
+	if errors.As(err, &se) {
+		return !se.reusable() && !errors.Is(err, ErrCommandTooLong)
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// outboxPath 返回临时目录中的日志路径, 测试结束后删除该目录
+func outboxPath(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "outbox.log")
+}
+
+func TestOutboxRejectsInvalidOps(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+
+	o, err := NewOutbox(ingest, outboxPath(t), OutboxOptions{})
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	defer o.Close()
+
+	errs := map[string]error{
+		"Push bucket":  o.Push("c", "b c", "o", "hello"),
+		"Push lang":    o.Push("c", "b", "o", "hello", WithLang("xx")),
+		"Pop":          o.Pop("c", "b", "", "hello"),
+		"FlushC":       o.FlushC("c\n"),
+		"FlushB":       o.FlushB("c", "\"b\""),
+		"FlushO":       o.FlushO("c", "b", "o o"),
+		"Push missing": o.Push("", "b", "o", "hello"),
+	}
+	for name, err := range errs {
+		if err == nil {
+			t.Errorf("%s accepted an invalid op", name)
+		}
+	}
+	if !errors.Is(errs["Push bucket"], ErrInvalidIdent) {
+		t.Errorf("Push with bad bucket = %v, want ErrInvalidIdent", errs["Push bucket"])
+	}
+	if n := o.Pending(); n != 0 {
+		t.Fatalf("invalid ops were logged: Pending = %d", n)
+	}
+}
+
+// sonic 不可用时写入的操作在重新打开日志后继续送达
+func TestOutboxReplay(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	ctx := testCtx(t)
+	path := outboxPath(t)
+	opt := OutboxOptions{RetryInterval: 20 * time.Millisecond}
+
+	s.RefuseFor(300 * time.Millisecond)
+
+	o, err := NewOutbox(ingest, path, opt)
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	for _, id := range []string{"o1", "o2", "o3"} {
+		if err := o.Push("c", "b", id, "hello"); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n, _ := ingest.Count(ctx, "c", "b", ""); n != 0 {
+		t.Fatalf("ops delivered while the server refused connections: Count = %d", n)
+	}
+
+	o, err = NewOutbox(ingest, path, opt)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer o.Close()
+	if err := o.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n, err := ingest.Count(ctx, "c", "b", ""); err != nil || n != 3 {
+		t.Fatalf("Count after replay = %d, %v, want 3", n, err)
+	}
+}
+
+func TestOutboxCompactThreshold(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	ctx := testCtx(t)
+	path := outboxPath(t)
+
+	o, err := NewOutbox(ingest, path, OutboxOptions{CompactThreshold: 3})
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	defer o.Close()
+
+	lines := func() int {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read log: %v", err)
+		}
+		return bytes.Count(b, []byte("\n"))
+	}
+
+	// 没到阈值时只追加确认记录, 不重写日志
+	for _, id := range []string{"o1", "o2"} {
+		if err := o.Push("c", "b", id, "hello"); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+		if err := o.Flush(ctx); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+	if n := lines(); n != 4 {
+		t.Fatalf("log has %d lines after 2 delivered ops, want 2 ops + 2 acks", n)
+	}
+
+	if err := o.Push("c", "b", "o3", "hello"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if err := o.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n := lines(); n != 0 {
+		t.Fatalf("log has %d lines after reaching CompactThreshold, want 0", n)
+	}
+}
+
+func TestOutboxLoadTornLines(t *testing.T) {
+	path := outboxPath(t)
+	ok := `{"seq":1,"op":"PUSH","collection":"c","bucket":"b","object":"o1","text":"hello"}` + "\n" +
+		`{"seq":2,"op":"PUSH","collection":"c","bucket":"b","object":"o2","text":"hello"}` + "\n"
+
+	// 最后一行不完整是写到一半时进程退出, 可以忽略
+	if err := ioutil.WriteFile(path, []byte(ok+`{"seq":3,"op":"PU`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := &Outbox{path: path}
+	if err := o.load(); err != nil || len(o.pending) != 2 {
+		t.Fatalf("load with a torn final line = %d pending, %v, want 2, nil", len(o.pending), err)
+	}
+
+	// 中间的行无法解析时, 后面的记录可能已经告诉过调用方写入成功, 不能跳过
+	torn := `{"seq":1,"op":"PUSH","collection":"c","bucket":"b","object":"o1","text":"hello"}` + "\n" +
+		`{"seq":2,"op":"PU{"seq":3,"op":"PUSH","collection":"c","bucket":"b","object":"o3","text":"hello"}` + "\n" +
+		`{"seq":4,"op":"PUSH","collection":"c","bucket":"b","object":"o4","text":"hello"}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(torn), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Outbox{path: path}).load(); err == nil {
+		t.Fatal("load skipped an undecodable line in the middle of the log")
+	}
+}
+
+func TestOutboxAppendFailure(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	path := outboxPath(t)
+	opt := OutboxOptions{RetryInterval: 20 * time.Millisecond, OpTimeout: 100 * time.Millisecond}
+
+	// 操作一直留在日志中, Pending 不会因为送达而变化
+	s.RefuseFor(time.Minute)
+
+	o, err := NewOutbox(ingest, path, opt)
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	if err := o.Push("c", "b", "o1", "hello"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	// 换成只读的文件, 写入和截断都会失败
+	o.mu.Lock()
+	w := o.f
+	o.f, err = os.Open(path)
+	o.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Push("c", "b", "o2", "hello"); err == nil {
+		t.Fatal("Push returned nil after the log write failed")
+	}
+	// 日志末尾无法恢复, 之后的写入不能再报告成功
+	if err := o.Push("c", "b", "o3", "hello"); !errors.Is(err, ErrOutboxBroken) {
+		t.Fatalf("Push after a failed truncate = %v, want ErrOutboxBroken", err)
+	}
+	if n := o.Pending(); n != 1 {
+		t.Fatalf("Pending = %d, want 1", n)
+	}
+
+	o.mu.Lock()
+	ro := o.f
+	o.f = w
+	o.mu.Unlock()
+	_ = ro.Close()
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	o, err = NewOutbox(ingest, path, opt)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer o.Close()
+	if n := o.Pending(); n != 1 {
+		t.Fatalf("Pending after reopen = %d, want 1", n)
+	}
+	if err := o.Push("c", "b", "o4", "hello"); err != nil {
+		t.Fatalf("Push after reopen: %v", err)
+	}
+}
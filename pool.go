@@ -3,7 +3,6 @@ package client
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -57,6 +56,12 @@ type Options struct {
 	Dialer    func(context.Context) (net.Conn, error)        // 发起网络连接的对象
 	OnClose   func(*Conn) error                              // 关闭连接时执行的操作
 	Connector func(context.Context, net.Conn) (*Conn, error) // 建立链接
+	Logger    Logger                                         // 日志输出, 为空时使用标准库 log
+	Retry     *RetryPolicy                                   // 重试策略, 为空时不重试
+	Breaker   BreakerConfig                                  // 拨号熔断器
+
+	ReadTimeout  time.Duration // 每次调用读取的超时时间
+	WriteTimeout time.Duration // 每次调用写入的超时时间
 
 	PoolSize           int           // 连接池大小
 	MinIdleConns       int           // 最小连接数
@@ -64,19 +69,15 @@ type Options struct {
 	PoolTimeout        time.Duration // 获取链接的等待时间
 	IdleTimeout        time.Duration // 链接空闲时间
 	IdleCheckFrequency time.Duration // 检查链接的间隔
-}
 
-type lastDialErrorWrap struct {
-	err error
+	minIdleSet bool // MinIdleConns 是调用方通过 WithMinIdle 或 DSN 设置的, 而不是默认值
 }
 
 // ConnPool connection pool
 type ConnPool struct {
 	opt *Options
 
-	dialErrorsNum uint32 // atomic
-
-	lastDialError atomic.Value
+	breaker *breaker
 
 	queue chan struct{}
 
@@ -95,7 +96,15 @@ type ConnPool struct {
 var _ Pooler = (*ConnPool)(nil)
 
 // NewConnPool new connection poll
+// PoolSize 小于等于 0 时连接池会死锁, 没有 Dialer 或 Connector 时无法建立链接, 这两种情况会 panic
+// 其余配置不做检查, 例如 PoolTimeout 为 0 时 Get 会立即返回 ErrPoolTimeout
 func NewConnPool(opt *Options) *ConnPool {
+	if opt.PoolSize <= 0 {
+		panic(errors.New("sonic: pool size must be greater than 0"))
+	}
+	if opt.Dialer == nil || opt.Connector == nil {
+		panic(errors.New("sonic: pool needs a Dialer and a Connector"))
+	}
 
 	p := &ConnPool{
 		opt: opt,
@@ -104,6 +113,7 @@ func NewConnPool(opt *Options) *ConnPool {
 		conns:     make([]*Conn, 0, opt.PoolSize),
 		idleConns: make([]*Conn, 0, opt.PoolSize),
 		closedCh:  make(chan struct{}),
+		breaker:   newBreaker(opt.Breaker, opt.PoolSize),
 	}
 
 	p.connsMu.Lock()
@@ -163,7 +173,7 @@ func (p *ConnPool) Get(ctx context.Context) (*Conn, error) {
 // Put 用完之后把链接还回来
 func (p *ConnPool) Put(cn *Conn) {
 	if cn.Buffered() > 0 { // 如果还有未读数据则扔掉该链接 并标记为坏链接
-		fmt.Printf("Conn has unread data")
+		p.logf("conn has unread data")
 		p.Remove(cn, BadConnError)
 		return
 	}
@@ -229,8 +239,12 @@ func (p *ConnPool) checkMinIdleConns() {
 }
 
 // addIdleConn 添加空闲链接
+// 后台建立的链接没有调用方的 ctx, 拨号和握手最多等待 PoolTimeout
 func (p *ConnPool) addIdleConn() error {
-	cn, err := p.dialConn(context.TODO(), true)
+	ctx, cancel := context.WithTimeout(context.Background(), p.opt.PoolTimeout)
+	defer cancel()
+
+	cn, err := p.dialConn(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -267,20 +281,7 @@ func (p *ConnPool) dialConn(ctx context.Context, pooled bool) (*Conn, error) {
 		return nil, ErrClosed
 	}
 
-	if atomic.LoadUint32(&p.dialErrorsNum) >= uint32(p.opt.PoolSize) {
-		return nil, p.getLastDialError()
-	}
-
-	netConn, err := p.opt.Dialer(ctx)
-	if err != nil {
-		p.setLastDialError(err)
-		if atomic.AddUint32(&p.dialErrorsNum, 1) == uint32(p.opt.PoolSize) {
-			go p.tryDial()
-		}
-		return nil, err
-	}
-
-	cn, err := p.opt.Connector(ctx, netConn)
+	cn, err := dial(ctx, p.opt, p.breaker)
 	if err != nil {
 		return nil, err
 	}
@@ -288,35 +289,30 @@ func (p *ConnPool) dialConn(ctx context.Context, pooled bool) (*Conn, error) {
 	return cn, nil
 }
 
-func (p *ConnPool) tryDial() {
-	for {
-		if p.closed() {
-			return
-		}
-
-		conn, err := p.opt.Dialer(context.Background())
-		if err != nil {
-			p.setLastDialError(err)
-			time.Sleep(time.Second)
-			continue
-		}
-
-		atomic.StoreUint32(&p.dialErrorsNum, 0)
-		_ = conn.Close()
-		return
+// dial 经过熔断器拨号并建立链接, 连接池和 SearchMux 共用
+func dial(ctx context.Context, opt *Options, b *breaker) (*Conn, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
 	}
-}
 
-func (p *ConnPool) setLastDialError(err error) {
-	p.lastDialError.Store(&lastDialErrorWrap{err: err})
-}
+	netConn, err := opt.Dialer(ctx)
+	if err != nil {
+		b.failure(err)
+		return nil, err
+	}
+	b.success()
 
-func (p *ConnPool) getLastDialError() error {
-	err, _ := p.lastDialError.Load().(*lastDialErrorWrap)
+	cn, err := opt.Connector(ctx, netConn)
 	if err != nil {
-		return err.err
+		_ = netConn.Close()
+		return nil, err
 	}
-	return nil
+	return cn, nil
+}
+
+// BreakerState 返回拨号熔断器的状态
+func (p *ConnPool) BreakerState() BreakerState {
+	return p.breaker.current()
 }
 
 func (p *ConnPool) getTurn() {
@@ -387,6 +383,54 @@ func (p *ConnPool) Remove(cn *Conn, reason error) {
 	_ = p.closeConn(cn)
 }
 
+// withConn 从连接池取出一个链接执行 fn, 执行完后根据错误决定归还还是移除
+func (p *ConnPool) withConn(ctx context.Context, fn func(*Conn) error) error {
+	cn, err := p.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = cn.setDeadline(ctx, p.opt.ReadTimeout, p.opt.WriteTimeout)
+	if err != nil {
+		p.Remove(cn, err)
+		return err
+	}
+
+	// ctx 取消时立即让正在进行的读写返回
+	netConn := cn.netConn
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	var aborted int32
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&aborted, 1)
+			_ = netConn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	err = fn(cn)
+	close(done)
+	<-exited
+	cn.ctx = nil
+
+	// 读写被打断的链接上可能还有未读的回复, 不能再复用
+	if err != nil && atomic.LoadInt32(&aborted) == 1 {
+		p.Remove(cn, err)
+		return ctx.Err()
+	}
+	if err != nil && isBadConn(err) {
+		p.Remove(cn, err)
+		return err
+	}
+
+	cn.setUsedAt(time.Now())
+	p.Put(cn)
+	return err
+}
+
 // CloseConn ...
 func (p *ConnPool) CloseConn(cn *Conn) error {
 	p.removeConnWithLock(cn)
@@ -449,6 +493,14 @@ func (p *ConnPool) Stats() *Stats {
 	}
 }
 
+func (p *ConnPool) logf(format string, v ...interface{}) {
+	if p.opt.Logger != nil {
+		p.opt.Logger.Printf(format, v...)
+		return
+	}
+	defaultLogger.Printf(format, v...)
+}
+
 func (p *ConnPool) closed() bool {
 	return atomic.LoadUint32(&p._closed) == 1
 }
@@ -483,7 +535,7 @@ func (p *ConnPool) reaper(frequency time.Duration) {
 			}
 			_, err := p.ReapStaleConns()
 			if err != nil {
-				fmt.Printf("ReapStaleConns failed: %s", err)
+				p.logf("ReapStaleConns failed: %s", err)
 				continue
 			}
 		case <-p.closedCh:
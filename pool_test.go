@@ -0,0 +1,259 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"TH9401/sonictest"
+)
+
+// quiet 丢弃连接池日志
+var quiet = WithLogger(log.New(ioutil.Discard, "", 0))
+
+func newTestServer(t *testing.T) *sonictest.Server {
+	t.Helper()
+	s := sonictest.NewServer("secret")
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestIngest(t *testing.T, s *sonictest.Server, opts ...Option) *IngestClient {
+	t.Helper()
+	opts = append([]Option{WithMinIdle(0), quiet}, opts...)
+	c, err := NewIngestClient(s.Addr(), "secret", opts...)
+	if err != nil {
+		t.Fatalf("NewIngestClient: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func newTestSearch(t *testing.T, addr string, opts ...Option) *SearchClient {
+	t.Helper()
+	opts = append([]Option{WithMinIdle(0), quiet}, opts...)
+	c, err := NewSearchClient(addr, "secret", opts...)
+	if err != nil {
+		t.Fatalf("NewSearchClient: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func testCtx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestPoolDropMidResponse(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	if err := c.Push(ctx, "c", "b", "o", "hello"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	s.Conns("ingest").DropMidResponse(1)
+	if _, err := c.Count(ctx, "c", "b", ""); err == nil {
+		t.Fatal("Count succeeded on a dropped response")
+	}
+	if n := c.pool.Len(); n != 0 {
+		t.Fatalf("broken conn kept in pool: Len = %d", n)
+	}
+
+	n, err := c.Count(ctx, "c", "b", "")
+	if err != nil || n != 1 {
+		t.Fatalf("Count after drop = %d, %v, want 1", n, err)
+	}
+}
+
+func TestPoolInjectLines(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	if err := c.Push(ctx, "c", "b", "o", "hello"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	// 多余的回复留在缓冲区中, 链接不能放回连接池, 否则下一次调用会读到错位的回复
+	s.Conns("ingest").InjectLines("RESULT 99")
+	if n, err := c.Count(ctx, "c", "b", ""); err != nil || n != 1 {
+		t.Fatalf("Count = %d, %v, want 1", n, err)
+	}
+	if n := c.pool.Len(); n != 0 {
+		t.Fatalf("conn with unread data kept in pool: Len = %d", n)
+	}
+	if n, err := c.Count(ctx, "c", "b", ""); err != nil || n != 1 {
+		t.Fatalf("Count after injected line = %d, %v, want 1", n, err)
+	}
+}
+
+func TestPoolRefuseFor(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	s.RefuseFor(300 * time.Millisecond)
+	if _, err := c.Count(ctx, "c", "", ""); err == nil {
+		t.Fatal("Count succeeded while the server refuses connections")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := c.Count(ctx, "c", "", "")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Count still failing after the server came back: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestPoolRejectPasswords(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	s.NextConns(1).RejectPasswords(true)
+	_, err := c.Count(ctx, "c", "", "")
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Count with rejected password = %v, want ErrAuthFailed", err)
+	}
+
+	// 只有下一个链接被拒绝, 重新拨号的链接可以认证
+	if _, err := c.Count(ctx, "c", "", ""); err != nil {
+		t.Fatalf("Count after accepting passwords: %v", err)
+	}
+}
+
+func TestPoolHandshakeDeadline(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+
+	s.NextConns(1).SetDelay(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.Count(ctx, "c", "", "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Count = %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Count returned after %v, handshake ignored the ctx deadline", d)
+	}
+}
+
+func TestNewConnPoolValidates(t *testing.T) {
+	s := newTestServer(t)
+	valid := connectOptions(s.Addr(), "secret", Ingest, Options{PoolSize: 1, PoolTimeout: time.Second})
+
+	tests := []Options{
+		{PoolSize: 0, PoolTimeout: time.Second, Dialer: valid.Dialer, Connector: valid.Connector},
+		{PoolSize: -1, PoolTimeout: time.Second, Dialer: valid.Dialer, Connector: valid.Connector},
+		{PoolSize: 1, PoolTimeout: time.Second, Connector: valid.Connector},
+		{PoolSize: 1, PoolTimeout: time.Second, Dialer: valid.Dialer},
+	}
+	for _, opt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewConnPool(%+v) did not panic", opt)
+				}
+			}()
+			NewConnPool(&opt)
+		}()
+	}
+
+	// PoolTimeout 为 0 时不 panic, 连接池满了之后 Get 立即返回 ErrPoolTimeout
+	opt := valid
+	opt.PoolTimeout = 0
+	p := NewConnPool(&opt)
+	defer p.Close()
+	ctx := testCtx(t)
+	cn, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer p.Put(cn)
+	if _, err := p.Get(ctx); !errors.Is(err, ErrPoolTimeout) {
+		t.Fatalf("Get from a full pool = %v, want ErrPoolTimeout", err)
+	}
+}
+
+func TestPoolTruncatedReply(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	if err := c.Push(ctx, "c", "b", "o", "hello"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	// 半行回复 "RESUL" 之后链接断开, FLUSHO 不能当作成功
+	s.Conns("ingest").DropMidResponse(1)
+	if _, err := c.FlushO(ctx, "c", "b", "o"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("FlushO with truncated reply = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if n := c.pool.Len(); n != 0 {
+		t.Fatalf("broken conn kept in pool: Len = %d", n)
+	}
+}
+
+// 每次调用结束后链接都回到连接池, 连续调用次数超过 PoolSize 也不会等待超时
+func TestClientsReturnConns(t *testing.T) {
+	s := newTestServer(t)
+	opts := []Option{WithPoolSize(2), WithPoolTimeout(100 * time.Millisecond)}
+	ingest := newTestIngest(t, s, opts...)
+	search := newTestSearch(t, s.Addr(), opts...)
+	ctx := testCtx(t)
+
+	if err := ingest.Push(ctx, "c", "b", "o", "hello world"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if _, err := search.Query(ctx, "c", "b", "hello", 10, 0); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	ingestLen, ingestIdle := ingest.pool.Len(), ingest.pool.IdleLen()
+	searchLen, searchIdle := search.pool.Len(), search.pool.IdleLen()
+
+	for i := 0; i < 5; i++ {
+		if err := ingest.Push(ctx, "c", "b", "o", "hello"); err != nil {
+			t.Fatalf("Push %d: %v", i, err)
+		}
+		if _, err := ingest.Count(ctx, "c", "b", "o"); err != nil {
+			t.Fatalf("Count %d: %v", i, err)
+		}
+		if err := ingest.Pop(ctx, "c", "b", "o", "hello"); err != nil {
+			t.Fatalf("Pop %d: %v", i, err)
+		}
+		if _, err := search.Query(ctx, "c", "b", "world", 10, 0); err != nil {
+			t.Fatalf("Query %d: %v", i, err)
+		}
+		if _, err := search.Suggest(ctx, "c", "b", "wor", 5); err != nil {
+			t.Fatalf("Suggest %d: %v", i, err)
+		}
+		if _, err := search.List(ctx, "c", "b", 10, 0); err != nil {
+			t.Fatalf("List %d: %v", i, err)
+		}
+	}
+	if _, err := ingest.FlushO(ctx, "c", "b", "o"); err != nil {
+		t.Fatalf("FlushO: %v", err)
+	}
+
+	if n, idle := ingest.pool.Len(), ingest.pool.IdleLen(); n != ingestLen || idle != ingestIdle {
+		t.Errorf("ingest pool Len, IdleLen = %d, %d, want %d, %d", n, idle, ingestLen, ingestIdle)
+	}
+	if n, idle := search.pool.Len(), search.pool.IdleLen(); n != searchLen || idle != searchIdle {
+		t.Errorf("search pool Len, IdleLen = %d, %d, want %d, %d", n, idle, searchLen, searchIdle)
+	}
+}
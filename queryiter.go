@@ -0,0 +1,106 @@
+package client
+
+import "context"
+
+// QueryIterator 分页遍历 QUERY 结果, 每次只在需要时取下一页
+//
+//	it := c.QueryIter(ctx, "messages", "default", "hello", 50)
+//	it.MaxResults = 1000
+//	for it.Next() {
+//		fmt.Println(it.Value())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type QueryIterator struct {
+	// MaxResults 最多返回的结果数, 0 表示不限制, 需要在第一次调用 Next 之前设置
+	MaxResults int
+
+	client     *SearchClient
+	ctx        context.Context
+	collection string
+	bucket     string
+	term       string
+	pageSize   int
+	opts       []CommandOption
+
+	page   []string
+	pos    int
+	offset int
+	count  int
+	last   bool // 已经取到最后一页
+	value  string
+	err    error
+}
+
+// QueryIter 返回 QUERY 结果的迭代器, pageSize 小于等于 0 时使用 10
+func (c *SearchClient) QueryIter(ctx context.Context, collection, bucket, term string, pageSize int, opts ...CommandOption) *QueryIterator {
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	return &QueryIterator{
+		client:     c,
+		ctx:        ctx,
+		collection: collection,
+		bucket:     bucket,
+		term:       term,
+		pageSize:   pageSize,
+		opts:       opts,
+	}
+}
+
+// Next 移动到下一个结果, 没有更多结果或出错时返回 false
+func (it *QueryIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.MaxResults > 0 && it.count >= it.MaxResults {
+		return false
+	}
+
+	if it.pos >= len(it.page) {
+		if it.last {
+			return false
+		}
+		if !it.fetch() {
+			return false
+		}
+	}
+
+	it.value = it.page[it.pos]
+	it.pos++
+	it.count++
+	return true
+}
+
+// fetch 取下一页, 不足一页时说明已经是最后一页
+func (it *QueryIterator) fetch() bool {
+	limit := it.pageSize
+	if it.MaxResults > 0 && it.MaxResults-it.count < limit {
+		limit = it.MaxResults - it.count
+	}
+
+	page, err := it.client.Query(it.ctx, it.collection, it.bucket, it.term, limit, it.offset, it.opts...)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.page = page
+	it.pos = 0
+	it.offset += len(page)
+	if len(page) < limit {
+		it.last = true
+	}
+	return len(page) > 0
+}
+
+// Value 当前的结果
+func (it *QueryIterator) Value() string {
+	return it.value
+}
+
+// Err 遍历过程中遇到的错误
+func (it *QueryIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestQueryIter(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	search := newTestSearch(t, s.Addr())
+	ctx := testCtx(t)
+
+	var want []string
+	for i := 0; i < 25; i++ {
+		id := fmt.Sprintf("o%02d", i)
+		if err := ingest.Push(ctx, "c", "b", id, "hello"); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+		// 最近写入的排在前面
+		want = append([]string{id}, want...)
+	}
+
+	tests := []struct {
+		pageSize   int
+		maxResults int
+		want       []string
+	}{
+		{10, 0, want},
+		{5, 0, want},
+		{25, 0, want},
+		{0, 0, want},
+		{10, 12, want[:12]},
+		{10, 30, want},
+	}
+	for _, tt := range tests {
+		it := search.QueryIter(ctx, "c", "b", "hello", tt.pageSize)
+		it.MaxResults = tt.maxResults
+		var got []string
+		for it.Next() {
+			got = append(got, it.Value())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("pageSize %d: Err = %v", tt.pageSize, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pageSize %d, MaxResults %d: got %v, want %v", tt.pageSize, tt.maxResults, got, tt.want)
+		}
+	}
+
+	it := search.QueryIter(ctx, "c", "b c", "hello", 10)
+	if it.Next() {
+		t.Fatal("Next returned true for an invalid bucket")
+	}
+	if !errors.Is(it.Err(), ErrInvalidIdent) {
+		t.Fatalf("Err = %v, want ErrInvalidIdent", it.Err())
+	}
+}
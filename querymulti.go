@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MergePolicy 多个目标的结果合并方式
+type MergePolicy int
+
+const (
+	// MergeInterleave 轮流从每个目标取一个结果, 各目标的排名交错在一起
+	MergeInterleave MergePolicy = iota
+
+	// MergePriority 按 targets 的顺序, 前面目标的结果全部排在后面目标之前
+	MergePriority
+)
+
+// Target 搜索的 collection 和 bucket
+type Target struct {
+	Collection string
+	Bucket     string
+}
+
+// MultiQueryOptions QueryMulti 的参数
+type MultiQueryOptions struct {
+	Limit       int         // 每个目标的 LIMIT, 默认 10
+	Offset      int         // 每个目标的 OFFSET
+	Lang        string      // 可选, 同 WithLang
+	Merge       MergePolicy // 合并方式, 默认 MergeInterleave
+	MaxResults  int         // 合并后最多返回的结果数, 0 表示不限制
+	Concurrency int         // 同时进行的 QUERY 数, 默认 8
+}
+
+// MultiResult 合并后的一个结果以及它来自哪个目标
+type MultiResult struct {
+	Object string
+	Target Target
+}
+
+// TargetError 一个目标的查询错误
+type TargetError struct {
+	Target Target
+	Err    error
+}
+
+// MultiQueryError 部分目标查询失败, 其余目标的结果仍然会返回
+type MultiQueryError struct {
+	Failures []TargetError
+}
+
+func (e *MultiQueryError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("%s/%s: %v", f.Target.Collection, f.Target.Bucket, f.Err))
+	}
+	return fmt.Sprintf("sonic: %d of the targets failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// QueryMulti 并发查询多个目标, 按 opts.Merge 合并并按对象 ID 去重, 重复的对象保留排在前面的那个
+// 部分目标失败时返回成功目标的结果和 *MultiQueryError
+func (c *SearchClient) QueryMulti(ctx context.Context, targets []Target, term string, opts MultiQueryOptions) ([]MultiResult, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+
+	var cmdOpts []CommandOption
+	if opts.Lang != "" {
+		cmdOpts = append(cmdOpts, WithLang(opts.Lang))
+	}
+
+	pages := make([][]string, len(targets))
+	errs := make([]error, len(targets))
+	sem := make(chan struct{}, opts.Concurrency)
+
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			pages[i], errs[i] = c.Query(ctx, t.Collection, t.Bucket, term, opts.Limit, opts.Offset, cmdOpts...)
+		}(i, t)
+	}
+	wg.Wait()
+
+	results := mergeResults(targets, pages, opts.Merge, opts.MaxResults)
+
+	var failures []TargetError
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, TargetError{Target: targets[i], Err: err})
+		}
+	}
+	if len(failures) > 0 {
+		return results, &MultiQueryError{Failures: failures}
+	}
+	return results, nil
+}
+
+// mergeResults 合并各目标的结果并去重
+func mergeResults(targets []Target, pages [][]string, policy MergePolicy, max int) []MultiResult {
+	var results []MultiResult
+	seen := make(map[string]struct{})
+	add := func(i int, object string) bool {
+		if max > 0 && len(results) >= max {
+			return false
+		}
+		if _, ok := seen[object]; !ok {
+			seen[object] = struct{}{}
+			results = append(results, MultiResult{Object: object, Target: targets[i]})
+		}
+		return true
+	}
+
+	switch policy {
+	case MergePriority:
+		for i, page := range pages {
+			for _, object := range page {
+				if !add(i, object) {
+					return results
+				}
+			}
+		}
+	default:
+		for rank := 0; ; rank++ {
+			more := false
+			for i, page := range pages {
+				if rank >= len(page) {
+					continue
+				}
+				more = true
+				if !add(i, page[rank]) {
+					return results
+				}
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return results
+}
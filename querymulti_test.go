@@ -0,0 +1,69 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQueryMulti(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	search := newTestSearch(t, s.Addr())
+	ctx := testCtx(t)
+
+	docs := []Document{
+		{Collection: "c", Bucket: "b1", Object: "a1", Text: "hello"},
+		{Collection: "c", Bucket: "b1", Object: "shared", Text: "hello"},
+		{Collection: "c", Bucket: "b2", Object: "b1", Text: "hello"},
+		{Collection: "c", Bucket: "b2", Object: "shared", Text: "hello"},
+		{Collection: "c", Bucket: "b2", Object: "b2", Text: "hello"},
+	}
+	for _, d := range docs {
+		if err := ingest.Push(ctx, d.Collection, d.Bucket, d.Object, d.Text); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+
+	one, two := Target{"c", "b1"}, Target{"c", "b2"}
+	objects := func(rs []MultiResult) (objs []string, targets []Target) {
+		for _, r := range rs {
+			objs = append(objs, r.Object)
+			targets = append(targets, r.Target)
+		}
+		return
+	}
+
+	tests := []struct {
+		name        string
+		opts        MultiQueryOptions
+		wantObjects []string
+		wantTargets []Target
+	}{
+		{"interleave", MultiQueryOptions{}, []string{"shared", "b2", "a1", "b1"}, []Target{one, two, one, two}},
+		{"priority", MultiQueryOptions{Merge: MergePriority}, []string{"shared", "a1", "b2", "b1"}, []Target{one, one, two, two}},
+		{"max results", MultiQueryOptions{MaxResults: 3}, []string{"shared", "b2", "a1"}, []Target{one, two, one}},
+		{"limit per target", MultiQueryOptions{Limit: 1, Concurrency: 1}, []string{"shared", "b2"}, []Target{one, two}},
+	}
+	for _, tt := range tests {
+		got, err := search.QueryMulti(ctx, []Target{one, two}, "hello", tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		objs, targets := objects(got)
+		if !reflect.DeepEqual(objs, tt.wantObjects) || !reflect.DeepEqual(targets, tt.wantTargets) {
+			t.Errorf("%s: got %v %v, want %v %v", tt.name, objs, targets, tt.wantObjects, tt.wantTargets)
+		}
+	}
+
+	// 部分目标失败时仍然返回其他目标的结果
+	bad := Target{"c", "b c"}
+	got, err := search.QueryMulti(ctx, []Target{bad, one}, "hello", MultiQueryOptions{})
+	var me *MultiQueryError
+	if !errors.As(err, &me) || len(me.Failures) != 1 || me.Failures[0].Target != bad || !errors.Is(me.Failures[0].Err, ErrInvalidIdent) {
+		t.Fatalf("QueryMulti with a bad target = %v, want *MultiQueryError for %v", err, bad)
+	}
+	if objs, _ := objects(got); !reflect.DeepEqual(objs, []string{"shared", "a1"}) {
+		t.Fatalf("partial results = %v", objs)
+	}
+}
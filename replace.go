@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ReplaceStep Replace 中出错的步骤
+type ReplaceStep string
+
+const (
+	// StepFlush FLUSHO 旧对象
+	StepFlush ReplaceStep = "flush"
+
+	// StepPop POP 删除的词
+	StepPop ReplaceStep = "pop"
+
+	// StepPush PUSH 新的文本
+	StepPush ReplaceStep = "push"
+)
+
+// ReplaceError 指明 Replace 在哪一步的第几个分片出错
+// 出错之前的步骤已经生效, 之后的步骤没有执行
+type ReplaceError struct {
+	Step  ReplaceStep
+	Chunk int // 出错的分片下标, FLUSHO 为 0
+	Err   error
+}
+
+func (e *ReplaceError) Error() string {
+	return fmt.Sprintf("sonic: replace failed at %s chunk %d: %v", e.Step, e.Chunk, e.Err)
+}
+
+// Unwrap ...
+func (e *ReplaceError) Unwrap() error {
+	return e.Err
+}
+
+// Replace 用 text 替换对象的内容, FLUSHO 和所有 PUSH 在同一个链接上依次执行
+// text 为空时只删除对象
+func (c *IngestClient) Replace(ctx context.Context, collection, bucket, object, text string, opts ...CommandOption) error {
+	o, err := newCommandOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	flush, err := NewCommand(string(flusho)).Ident(collection).Ident(bucket).Ident(object).Build()
+	if err != nil {
+		return err
+	}
+
+	return c.pool.withRetry(ctx, true, func(conn *Conn) error {
+		if _, err := conn.roundTrip(flush); err != nil {
+			return &ReplaceError{Step: StepFlush, Err: err}
+		}
+		return conn.replaceText(StepPush, push, collection, bucket, object, text, o.lang)
+	})
+}
+
+// ReplaceDiff 根据旧文本计算差异, 只 POP 删除的词, 只 PUSH 新增的词
+// 对象在替换过程中不会出现为空的情况
+func (c *IngestClient) ReplaceDiff(ctx context.Context, collection, bucket, object, previous, text string, opts ...CommandOption) error {
+	o, err := newCommandOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	removed, added := diffWords(previous, text)
+	if len(removed) == 0 && len(added) == 0 {
+		return nil
+	}
+
+	return c.pool.withRetry(ctx, true, func(conn *Conn) error {
+		// 先 PUSH 再 POP, 新旧文本共有的词始终可以被搜到
+		if len(added) > 0 {
+			err := conn.replaceText(StepPush, push, collection, bucket, object, strings.Join(added, " "), o.lang)
+			if err != nil {
+				return err
+			}
+		}
+		if len(removed) > 0 {
+			return conn.replaceText(StepPop, pop, collection, bucket, object, strings.Join(removed, " "), "")
+		}
+		return nil
+	})
+}
+
+// replaceText 分片发送 PUSH 或 POP, 出错时返回 *ReplaceError
+func (c *Conn) replaceText(step ReplaceStep, cmd ingesteCommands, collection, bucket, object, text, lang string) error {
+	for i, chunk := range c.splitText(text) {
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+		command := NewCommand(string(cmd)).Ident(collection).Ident(bucket).Ident(object).Text(chunk)
+		if lang != "" {
+			command.Param("LANG", lang)
+		}
+		line, err := command.Build()
+		if err == nil {
+			_, err = c.roundTrip(line)
+		}
+		if err != nil {
+			return &ReplaceError{Step: step, Chunk: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// diffWords 按词比较新旧文本, 忽略大小写和标点
+func diffWords(previous, text string) (removed, added []string) {
+	words := func(s string) ([]string, map[string]struct{}) {
+		var list []string
+		set := make(map[string]struct{})
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if _, ok := set[w]; !ok {
+				set[w] = struct{}{}
+				list = append(list, w)
+			}
+		}
+		return list, set
+	}
+
+	prevList, prevSet := words(previous)
+	nextList, nextSet := words(text)
+	for _, w := range prevList {
+		if _, ok := nextSet[w]; !ok {
+			removed = append(removed, w)
+		}
+	}
+	for _, w := range nextList {
+		if _, ok := prevSet[w]; !ok {
+			added = append(added, w)
+		}
+	}
+	return removed, added
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiffWords(t *testing.T) {
+	removed, added := diffWords("The quick brown fox", "the QUICK red fox, the end")
+	if !reflect.DeepEqual(removed, []string{"brown"}) || !reflect.DeepEqual(added, []string{"red", "end"}) {
+		t.Fatalf("diffWords = %v, %v, want [brown], [red end]", removed, added)
+	}
+	if removed, added := diffWords("a b", "B, a!"); removed != nil || added != nil {
+		t.Fatalf("diffWords of equal texts = %v, %v, want nothing", removed, added)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	search := newTestSearch(t, s.Addr())
+	ctx := testCtx(t)
+
+	query := func(terms string) []string {
+		t.Helper()
+		got, err := search.Query(ctx, "c", "b", terms, 10, 0)
+		if err != nil {
+			t.Fatalf("Query %q: %v", terms, err)
+		}
+		return got
+	}
+
+	if err := ingest.Push(ctx, "c", "b", "o", "old text"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if err := ingest.Replace(ctx, "c", "b", "o", "new text"); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if got := query("old"); len(got) != 0 {
+		t.Fatalf("Query old word after Replace = %v, want none", got)
+	}
+	if got := query("new"); !reflect.DeepEqual(got, []string{"o"}) {
+		t.Fatalf("Query new word after Replace = %v, want [o]", got)
+	}
+
+	if err := ingest.ReplaceDiff(ctx, "c", "b", "o", "new text", "newer text"); err != nil {
+		t.Fatalf("ReplaceDiff: %v", err)
+	}
+	for terms, want := range map[string]int{"new": 0, "newer": 1, "text": 1} {
+		if got := query(terms); len(got) != want {
+			t.Errorf("Query %q after ReplaceDiff = %v, want %d results", terms, got, want)
+		}
+	}
+
+	// 空文本只删除对象
+	if err := ingest.Replace(ctx, "c", "b", "o", ""); err != nil {
+		t.Fatalf("Replace with empty text: %v", err)
+	}
+	if n, err := ingest.Count(ctx, "c", "b", ""); err != nil || n != 0 {
+		t.Fatalf("Count after empty Replace = %d, %v, want 0", n, err)
+	}
+}
+
+func TestReplaceError(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	ctx := testCtx(t)
+
+	if err := ingest.Replace(ctx, "c", "b c", "o", "text"); !errors.Is(err, ErrInvalidIdent) {
+		t.Fatalf("Replace with bad bucket = %v, want ErrInvalidIdent", err)
+	}
+
+	// 先建立链接, 故障只落在 FLUSHO 的回复上
+	if err := ingest.Push(ctx, "c", "b", "o", "text"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	s.Conns("ingest").DropMidResponse(1)
+	err := ingest.Replace(ctx, "c", "b", "o", "text")
+	var re *ReplaceError
+	if !errors.As(err, &re) || re.Step != StepFlush || re.Chunk != 0 {
+		t.Fatalf("Replace with dropped FLUSHO reply = %v, want ReplaceError at flush", err)
+	}
+
+	// FLUSHO 已经在服务端生效, 重新 Replace 即可恢复
+	if err := ingest.Replace(ctx, "c", "b", "o", "text"); err != nil {
+		t.Fatalf("Replace after failure: %v", err)
+	}
+	if n, err := ingest.Count(ctx, "c", "b", "o"); err != nil || n != 1 {
+		t.Fatalf("Count after Replace = %d, %v, want 1", n, err)
+	}
+}
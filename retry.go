@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy 命令失败后的重试策略, 每次重试都会从连接池重新取链接
+// QUERY, SUGGEST, LIST, COUNT, FLUSH 和 INFO 总是按策略重试, PUSH, POP 和 Replace 需要设置 RetryWrites
+type RetryPolicy struct {
+	MaxAttempts int           // 最多尝试次数, 包括第一次, 小于等于 1 表示不重试
+	BaseBackoff time.Duration // 第一次重试前的等待时间, 之后每次翻倍, 默认 50ms
+	MaxBackoff  time.Duration // 等待时间上限, 默认 2s
+	Jitter      float64       // 等待时间随机减少的比例, 取值 0 到 1
+	RetryWrites bool          // PUSH, POP 和 Replace 是否重试, 重试可能导致重复写入
+
+	// Retryable 判断错误是否需要重试, 为空时使用 DefaultRetryable
+	Retryable func(error) bool
+}
+
+// DefaultRetryable 链接损坏、回复无法解析、连接池超时、拨号失败和服务器关闭时重试
+// 服务端拒绝的命令、参数错误、熔断和 ctx 结束都不重试
+func DefaultRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrInvalidIdent) || errors.Is(err, ErrInvalidArgument) || errors.Is(err, ErrClosed) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if errors.Is(err, BadConnError) || errors.Is(err, ErrPoolTimeout) || errors.Is(err, ErrProtocol) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var se *ServerError
+	if errors.As(err, &se) {
+		return !se.reusable() && !errors.Is(err, ErrCommandTooLong) && !errors.Is(err, ErrAuthFailed)
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// backoff 第 attempt 次重试前的等待时间
+func (rp *RetryPolicy) backoff(attempt int) time.Duration {
+	base, max := rp.BaseBackoff, rp.MaxBackoff
+	if base <= 0 {
+		base = 50 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 2 * time.Second
+	}
+
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if rp.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * rp.Jitter * float64(d))
+	}
+	return d
+}
+
+func (rp *RetryPolicy) retryable(err error) bool {
+	if rp.Retryable != nil {
+		return rp.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// withRetry 按连接池的重试策略执行 fn, write 为 true 时只在 RetryWrites 打开时重试
+func (p *ConnPool) withRetry(ctx context.Context, write bool, fn func(*Conn) error) error {
+	rp := p.opt.Retry
+	if rp == nil || rp.MaxAttempts <= 1 || (write && !rp.RetryWrites) {
+		return p.withConn(ctx, fn)
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = p.withConn(ctx, fn)
+		if err == nil || attempt >= rp.MaxAttempts || !rp.retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(rp.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	rp := RetryPolicy{BaseBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for attempt, want := range map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 40 * time.Millisecond,
+		4: 50 * time.Millisecond,
+		9: 50 * time.Millisecond,
+	} {
+		if d := rp.backoff(attempt); d != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, d, want)
+		}
+	}
+
+	rp.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := rp.backoff(3); d <= 20*time.Millisecond || d > 40*time.Millisecond {
+			t.Fatalf("backoff(3) with jitter = %s, want (20ms, 40ms]", d)
+		}
+	}
+
+	if d := (&RetryPolicy{}).backoff(1); d != 50*time.Millisecond {
+		t.Errorf("default backoff(1) = %s, want 50ms", d)
+	}
+}
+
+func TestDefaultRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{ErrPoolTimeout, true},
+		{ErrProtocol, true},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{ErrInvalidIdent, false},
+		{ErrInvalidArgument, false},
+		{ErrCircuitOpen, false},
+		{ErrClosed, false},
+		{newServerError("authentication_failed"), false},
+		{newServerError("query_error"), false},
+		{errors.New("other"), false},
+	}
+	for _, tt := range tests {
+		if got := DefaultRetryable(tt.err); got != tt.want {
+			t.Errorf("DefaultRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s, WithRetry(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}))
+	ctx := testCtx(t)
+
+	if err := c.Push(ctx, "c", "b", "o", "hello"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	// 读命令按策略重试
+	s.Conns("ingest").DropMidResponse(2)
+	if n, err := c.Count(ctx, "c", "b", ""); err != nil || n != 1 {
+		t.Fatalf("Count after 2 dropped replies = %d, %v, want 1", n, err)
+	}
+
+	s.Conns("ingest").DropMidResponse(3)
+	if _, err := c.Count(ctx, "c", "b", ""); err == nil {
+		t.Fatal("Count succeeded after MaxAttempts dropped replies")
+	}
+	s.ResetFaults()
+
+	// 没有 RetryWrites 时写命令不重试
+	s.Conns("ingest").DropMidResponse(1)
+	if err := c.Push(ctx, "c", "b", "o2", "hello"); err == nil {
+		t.Fatal("Push was retried without RetryWrites")
+	}
+	s.ResetFaults()
+
+	// 参数错误不重试, 也不会用到链接
+	if _, err := c.Count(ctx, "c", "b c", ""); !errors.Is(err, ErrInvalidIdent) {
+		t.Fatalf("Count with bad bucket = %v, want ErrInvalidIdent", err)
+	}
+}
+
+func TestRetryWrites(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestIngest(t, s, WithRetry(RetryPolicy{MaxAttempts: 2, BaseBackoff: time.Millisecond, RetryWrites: true}))
+	ctx := testCtx(t)
+
+	if _, err := c.Count(ctx, "c", "b", ""); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	s.Conns("ingest").DropMidResponse(1)
+	if err := c.Push(ctx, "c", "b", "o", "hello"); err != nil {
+		t.Fatalf("Push with RetryWrites: %v", err)
+	}
+	if n, err := c.Count(ctx, "c", "b", ""); err != nil || n != 1 {
+		t.Fatalf("Count = %d, %v, want 1", n, err)
+	}
+}
@@ -1,11 +1,7 @@
 package client
 
 import (
-	"bytes"
 	"context"
-	"net"
-	"strconv"
-	"time"
 )
 
 type searchCommands string
@@ -13,94 +9,128 @@ type searchCommands string
 const (
 	query   searchCommands = "QUERY"
 	suggest searchCommands = "SUGGEST"
+	list    searchCommands = "LIST"
 )
 
 // SearchClient ...
 type SearchClient struct {
-	channel  string
-	endpoint string
-	password string
-	port     int
-	pool     *ConnPool
+	channel   string
+	endpoint  string
+	password  string
+	port      int
+	pool      *ConnPool
+	hydration *hydration
 }
 
 // NweSearchClient ...
+//
+// Deprecated: 使用 NewSearchClient
 func NweSearchClient(endpoint, password string, port int) (client *SearchClient) {
+	client, _ = NewSearchClient(joinEndpoint(endpoint, port), password)
+	return
+}
+
+// NewSearchClient ...
+func NewSearchClient(endpoint, password string, opts ...Option) (*SearchClient, error) {
+	return newSearchClient(endpoint, password, applyOptions(defaultOptions(), opts))
+}
 
-	dialer := func(ctx context.Context) (netConn net.Conn, err error) {
-		netConn, err = net.Dial("tcp", endpoint)
-		if err != nil {
-			return nil, err
-		}
-		return
+func newSearchClient(endpoint, password string, opt Options) (*SearchClient, error) {
+	pool, err := newPool(endpoint, password, Search, opt)
+	if err != nil {
+		return nil, err
 	}
+	return &SearchClient{
+		pool:     pool,
+		endpoint: endpoint,
+		password: password,
+	}, nil
+}
 
-	connector := func(ctx context.Context, netConn net.Conn) (conn *Conn, err error) {
-		return NewConn(netConn, Search, password)
+// Close 关闭连接池, 并停止 Hydrator 的后台清理
+func (c *SearchClient) Close() error {
+	if c.hydration != nil {
+		c.hydration.close()
 	}
+	return c.pool.Close()
+}
 
-	opt := &Options{
-		Dialer:    dialer,
-		OnClose:   nil,
-		Connector: connector,
-
-		PoolSize:           40,
-		MinIdleConns:       10,
-		MaxConnAge:         time.Minute,
-		PoolTimeout:        time.Second * 2,
-		IdleTimeout:        time.Second * 30,
-		IdleCheckFrequency: time.Second * 2,
+// Query ...
+func (c *SearchClient) Query(ctx context.Context, collection, bucket, term string, limit, offset int, opts ...CommandOption) (results []string, err error) {
+	o, err := newCommandOptions(opts)
+	if err != nil {
+		return nil, err
 	}
+	return c.search(ctx, buildQuery(collection, bucket, term, limit, offset, o.lang), query)
+}
 
-	client = &SearchClient{
-		pool:     NewConnPool(opt),
-		endpoint: endpoint,
-		password: password,
-		port:     port,
+// Suggest ...
+func (c *SearchClient) Suggest(ctx context.Context, collection, bucket, word string, limit int) (results []string, err error) {
+	return c.search(ctx, buildSuggest(collection, bucket, word, limit), suggest)
+}
+
+// List 列出 bucket 中已索引的词
+func (c *SearchClient) List(ctx context.Context, collection, bucket string, limit, offset int) (results []string, err error) {
+	return c.search(ctx, buildList(collection, bucket, limit, offset), list)
+}
+
+func buildQuery(collection, bucket, term string, limit, offset int, lang string) *Command {
+	cmd := NewCommand(string(query)).Ident(collection).Ident(bucket).Text(term).
+		IntParam("LIMIT", limit).IntParam("OFFSET", offset)
+	if lang != "" {
+		cmd.Param("LANG", lang)
 	}
+	return cmd
+}
 
-	return
+func buildSuggest(collection, bucket, word string, limit int) *Command {
+	return NewCommand(string(suggest)).Ident(collection).Ident(bucket).Text(word).IntParam("LIMIT", limit)
 }
 
-// Query ...
-func (c *SearchClient) Query(ctx context.Context, collection, bucket, term string, limit, offset int) (results []string, err error) {
+func buildList(collection, bucket string, limit, offset int) *Command {
+	return NewCommand(string(list)).Ident(collection).Ident(bucket).IntParam("LIMIT", limit).IntParam("OFFSET", offset)
+}
 
-	conn, err := c.pool.Get(ctx)
+// search 在连接池的链接上执行搜索命令
+func (c *SearchClient) search(ctx context.Context, command *Command, eventType searchCommands) (results []string, err error) {
+	cmd, err := command.Build()
 	if err != nil {
 		return nil, err
 	}
 
-	var buf bytes.Buffer
-	buf.WriteString(string(query))
-	buf.WriteString(" ")
-	buf.WriteString(collection)
-	buf.WriteString(" ")
-	buf.WriteString(bucket)
-	buf.WriteString(" ")
-	buf.WriteString("\"")
-	buf.WriteString(term)
-	buf.WriteString("\"")
-	buf.WriteString("LIMIT(")
-	buf.WriteString(strconv.Itoa(limit))
-	buf.WriteString(") OFFSET(")
-	buf.WriteString(strconv.Itoa(offset))
-	buf.WriteString(")")
-
-	err = conn.write(buf.String())
+	err = c.pool.withRetry(ctx, false, func(conn *Conn) error {
+		results, err = conn.searchEvent(cmd, eventType)
+		return err
+	})
+	return results, err
+}
+
+// searchEvent 发送搜索命令并等待对应的 EVENT
+func (c *Conn) searchEvent(cmd string, eventType searchCommands) (results []string, err error) {
+	err = c.write(cmd)
 	if err != nil {
 		return nil, err
 	}
 
 	// pending, should be PENDING ID_EVENT
-	_, err = conn.read()
+	_, err = c.read()
 	if err != nil {
 		return nil, err
 	}
 
-	// event query, should be EVENT QUERY ID_EVENT RESULT1 RESULT2 ...
-	read, err := conn.read()
+	// event, should be EVENT QUERY|SUGGEST|LIST ID_EVENT RESULT1 RESULT2 ...
+	read, err := c.read()
 	if err != nil {
 		return nil, err
 	}
-	return getSearchResults(read, string(query)), nil
+	return getSearchResults(read, string(eventType)), nil
+}
+
+// Handshake 返回服务端的握手信息, 可以据此判断支持的命令
+func (c *SearchClient) Handshake(ctx context.Context) (hs Handshake, err error) {
+	err = c.pool.withConn(ctx, func(conn *Conn) error {
+		hs = conn.Handshake()
+		return nil
+	})
+	return hs, err
 }
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchClientSuggestList(t *testing.T) {
+	s := newTestServer(t)
+	ingest := newTestIngest(t, s)
+	search := newTestSearch(t, s.Addr())
+	ctx := testCtx(t)
+
+	if err := ingest.Push(ctx, "c", "b", "o1", "apple apricot banana"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if err := ingest.Push(ctx, "c", "b", "o2", "avocado cherry"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	suggests := []struct {
+		word  string
+		limit int
+		want  []string
+	}{
+		{"ap", 5, []string{"apple", "apricot"}},
+		{"a", 2, []string{"apple", "apricot"}},
+		{"ch", 5, []string{"cherry"}},
+		{"zz", 5, []string{}},
+	}
+	for _, tt := range suggests {
+		got, err := search.Suggest(ctx, "c", "b", tt.word, tt.limit)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Suggest(%q, %d) = %v, %v, want %v", tt.word, tt.limit, got, err, tt.want)
+		}
+	}
+
+	// 按 LIMIT 和 OFFSET 分页列出所有词
+	lists := []struct {
+		limit, offset int
+		want          []string
+	}{
+		{10, 0, []string{"apple", "apricot", "avocado", "banana", "cherry"}},
+		{2, 0, []string{"apple", "apricot"}},
+		{2, 2, []string{"avocado", "banana"}},
+		{2, 4, []string{"cherry"}},
+		{2, 6, []string{}},
+	}
+	for _, tt := range lists {
+		got, err := search.List(ctx, "c", "b", tt.limit, tt.offset)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("List(%d, %d) = %v, %v, want %v", tt.limit, tt.offset, got, err, tt.want)
+		}
+	}
+}
+
+func TestSearchClientQueryCancel(t *testing.T) {
+	s := newTestServer(t)
+	search := newTestSearch(t, s.Addr())
+
+	if _, err := search.Query(testCtx(t), "c", "b", "hello", 10, 0); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	old := search.pool.idleConns[0]
+
+	s.Conns("search").SetDelay(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := search.Query(ctx, "c", "b", "hello", 10, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Query = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Query returned %v after cancel, want promptly", d)
+	}
+
+	// 回复还在路上, 链接不能放回连接池
+	if n := search.pool.Len(); n != 0 {
+		t.Fatalf("cancelled conn kept in pool: Len = %d", n)
+	}
+	s.ResetFaults()
+	if _, err := search.Query(testCtx(t), "c", "b", "hello", 10, 0); err != nil {
+		t.Fatalf("Query after cancel: %v", err)
+	}
+	if cn := search.pool.idleConns[0]; cn == old {
+		t.Fatal("Query after cancel reused the cancelled conn")
+	}
+}
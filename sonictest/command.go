@@ -0,0 +1,104 @@
+package sonictest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// command 解析后的一行命令
+type command struct {
+	name   string
+	args   []string          // 普通参数
+	text   string            // 引号中的文本, 已经反转义
+	quoted bool              // 是否带有引号文本
+	params map[string]string // LIMIT(10) 这样的参数, key 为大写
+}
+
+// parseCommand 解析一行命令, 引号中的 \\ \n \" 会被反转义
+func parseCommand(line string) (*command, bool) {
+	cmd := &command{params: make(map[string]string)}
+
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '"':
+			flush()
+			text, n, ok := unquote(line[i+1:])
+			if !ok || cmd.quoted {
+				return nil, false
+			}
+			cmd.text = text
+			cmd.quoted = true
+			// 引号文本在参数中的位置用空字符串占位
+			tokens = append(tokens, "\x00")
+			i += n + 1
+		case ch == ' ' || ch == '\t':
+			flush()
+		default:
+			cur.WriteByte(ch)
+		}
+	}
+	flush()
+
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	cmd.name = strings.ToUpper(tokens[0])
+	for _, t := range tokens[1:] {
+		if t == "\x00" {
+			continue
+		}
+		if l := strings.IndexByte(t, '('); l > 0 && strings.HasSuffix(t, ")") {
+			cmd.params[strings.ToUpper(t[:l])] = t[l+1 : len(t)-1]
+			continue
+		}
+		cmd.args = append(cmd.args, t)
+	}
+	return cmd, true
+}
+
+// unquote 读取到下一个未转义的引号, 返回文本和消耗的字节数
+func unquote(s string) (string, int, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, false
+			}
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), i + 1, true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, false
+}
+
+// intParam 读取整数参数, 没有时返回默认值
+func (c *command) intParam(key string, def int) (int, bool) {
+	v, ok := c.params[key]
+	if !ok {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
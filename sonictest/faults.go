@@ -0,0 +1,180 @@
+package sonictest
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Faults 注入到一部分链接上的故障, 用于测试连接池的恢复
+// 由 NextConns 或 Conns 创建, 只作用于选中的链接, 其他链接 (例如连接池后台建立的空闲链接) 不受影响
+type Faults struct {
+	match func(*session) bool
+
+	mu          sync.Mutex
+	delay       time.Duration // 每行回复前的延迟
+	drops       int           // 接下来需要在回复中途断开的次数
+	extra       []string      // 跟在下一行回复后面的多余行
+	rejectLogin bool          // 拒绝 START
+}
+
+// NextConns 作用于调用之后接受的 n 个链接, 从 CONNECTED 开始的每一行回复都会受影响
+// 用于测试握手超时和认证失败
+func (s *Server) NextConns(n int) *Faults {
+	s.mu.Lock()
+	first, last := s.accepted+1, s.accepted+n
+	s.mu.Unlock()
+
+	return s.addFaults(func(ss *session) bool {
+		return ss.id >= first && ss.id <= last
+	})
+}
+
+// Conns 作用于已经 START 到 mode 通道的链接, mode 为空时不限通道
+// 只影响命令的回复, CONNECTED 和 STARTED 不受影响
+func (s *Server) Conns(mode string) *Faults {
+	return s.addFaults(func(ss *session) bool {
+		return ss.mode != "" && (mode == "" || ss.mode == mode)
+	})
+}
+
+func (s *Server) addFaults(match func(*session) bool) *Faults {
+	f := &Faults{match: match}
+	s.faultsMu.Lock()
+	s.faults = append(s.faults, f)
+	s.faultsMu.Unlock()
+	return f
+}
+
+// SetDelay 之后的每一行回复都延迟 d, 0 表示取消延迟
+func (f *Faults) SetDelay(d time.Duration) *Faults {
+	f.mu.Lock()
+	f.delay = d
+	f.mu.Unlock()
+	return f
+}
+
+// DropMidResponse 接下来的 n 行回复只写一半, 然后断开链接
+func (f *Faults) DropMidResponse(n int) *Faults {
+	f.mu.Lock()
+	f.drops = n
+	f.mu.Unlock()
+	return f
+}
+
+// InjectLines 在下一行回复之后紧跟着发送多余的行, 客户端读完回复后缓冲区中会留有未读数据
+func (f *Faults) InjectLines(lines ...string) *Faults {
+	f.mu.Lock()
+	f.extra = append(f.extra, lines...)
+	f.mu.Unlock()
+	return f
+}
+
+// RejectPasswords 为 true 时 START 都返回认证失败
+func (f *Faults) RejectPasswords(reject bool) *Faults {
+	f.mu.Lock()
+	f.rejectLogin = reject
+	f.mu.Unlock()
+	return f
+}
+
+// RefuseFor 关闭监听 d 时间, 期间新的连接会被拒绝, 已有链接不受影响
+func (s *Server) RefuseFor(d time.Duration) {
+	s.mu.Lock()
+	if s.closed || s.ln == nil {
+		s.mu.Unlock()
+		return
+	}
+	_ = s.ln.Close()
+	s.ln = nil
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-s.done:
+			return
+		}
+
+		// 端口可能还没有释放, 重试直到成功或服务器关闭
+		for {
+			ln, err := net.Listen("tcp", s.addr)
+			if err == nil {
+				s.mu.Lock()
+				if s.closed {
+					s.mu.Unlock()
+					_ = ln.Close()
+					return
+				}
+				s.ln = ln
+				s.wg.Add(1)
+				s.mu.Unlock()
+				go s.serve(ln)
+				return
+			}
+
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// ResetFaults 清除所有注入的故障, 不会恢复被 RefuseFor 关闭的监听
+func (s *Server) ResetFaults() {
+	s.faultsMu.Lock()
+	s.faults = nil
+	s.faultsMu.Unlock()
+}
+
+// matching 返回作用于 ss 的故障
+func (s *Server) matching(ss *session) []*Faults {
+	s.faultsMu.Lock()
+	defer s.faultsMu.Unlock()
+
+	var list []*Faults
+	for _, f := range s.faults {
+		if f.match(ss) {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// takeFaults 取出 ss 下一行回复需要注入的故障, 多组故障同时作用时延迟取最大值
+func (s *Server) takeFaults(ss *session) (delay time.Duration, drop bool, extra []string) {
+	for _, f := range s.matching(ss) {
+		f.mu.Lock()
+		if f.delay > delay {
+			delay = f.delay
+		}
+		if !drop && f.drops > 0 {
+			f.drops--
+			drop = true
+		}
+		extra = append(extra, f.extra...)
+		f.extra = nil
+		f.mu.Unlock()
+	}
+	return
+}
+
+// rejectPasswords ss 的 START 是否需要返回认证失败
+func (s *Server) rejectPasswords(ss *session) bool {
+	for _, f := range s.matching(ss) {
+		f.mu.Lock()
+		reject := f.rejectLogin
+		f.mu.Unlock()
+		if reject {
+			return true
+		}
+	}
+	return false
+}
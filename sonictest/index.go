@@ -0,0 +1,207 @@
+package sonictest
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// object 一个对象的索引
+type object struct {
+	seq   uint64 // 最后一次 PUSH 的顺序, 查询结果按其倒序排列
+	words map[string]struct{}
+}
+
+// index 内存中的倒排索引, collection -> bucket -> object
+type index struct {
+	seq         uint64
+	collections map[string]map[string]map[string]*object
+}
+
+func newIndex() *index {
+	return &index{collections: make(map[string]map[string]map[string]*object)}
+}
+
+// tokenize 按非字母数字切分并转成小写
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (idx *index) bucket(collection, bucket string, create bool) map[string]*object {
+	buckets, ok := idx.collections[collection]
+	if !ok {
+		if !create {
+			return nil
+		}
+		buckets = make(map[string]map[string]*object)
+		idx.collections[collection] = buckets
+	}
+	objects, ok := buckets[bucket]
+	if !ok && create {
+		objects = make(map[string]*object)
+		buckets[bucket] = objects
+	}
+	return objects
+}
+
+func (idx *index) push(collection, bucket, obj, text string) {
+	objects := idx.bucket(collection, bucket, true)
+	o, ok := objects[obj]
+	if !ok {
+		o = &object{words: make(map[string]struct{})}
+		objects[obj] = o
+	}
+	idx.seq++
+	o.seq = idx.seq
+	for _, w := range tokenize(text) {
+		o.words[w] = struct{}{}
+	}
+}
+
+func (idx *index) pop(collection, bucket, obj, text string) int {
+	o := idx.bucket(collection, bucket, false)[obj]
+	if o == nil {
+		return 0
+	}
+	n := 0
+	for _, w := range tokenize(text) {
+		if _, ok := o.words[w]; ok {
+			delete(o.words, w)
+			n++
+		}
+	}
+	if len(o.words) == 0 {
+		delete(idx.bucket(collection, bucket, false), obj)
+	}
+	return n
+}
+
+// count 和 sonic 一致: 只给 collection 返回 bucket 数, 给 bucket 返回对象数, 给 object 返回词数
+func (idx *index) count(collection, bucket, obj string) int {
+	if bucket == "" {
+		return len(idx.collections[collection])
+	}
+	objects := idx.bucket(collection, bucket, false)
+	if obj == "" {
+		return len(objects)
+	}
+	if o := objects[obj]; o != nil {
+		return len(o.words)
+	}
+	return 0
+}
+
+func (idx *index) flushCollection(collection string) int {
+	n := len(idx.collections[collection])
+	delete(idx.collections, collection)
+	return n
+}
+
+func (idx *index) flushBucket(collection, bucket string) int {
+	n := len(idx.bucket(collection, bucket, false))
+	if buckets, ok := idx.collections[collection]; ok {
+		delete(buckets, bucket)
+	}
+	return n
+}
+
+func (idx *index) flushObject(collection, bucket, obj string) int {
+	objects := idx.bucket(collection, bucket, false)
+	o := objects[obj]
+	if o == nil {
+		return 0
+	}
+	delete(objects, obj)
+	return len(o.words)
+}
+
+// query 返回包含所有词的对象, 最近写入的在前
+func (idx *index) query(collection, bucket, terms string, limit, offset int) []string {
+	words := tokenize(terms)
+	if len(words) == 0 {
+		return nil
+	}
+
+	type hit struct {
+		id  string
+		seq uint64
+	}
+	var hits []hit
+	for id, o := range idx.bucket(collection, bucket, false) {
+		matched := true
+		for _, w := range words {
+			if _, ok := o.words[w]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			hits = append(hits, hit{id, o.seq})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].seq > hits[j].seq })
+
+	ids := make([]string, 0, len(hits))
+	for _, h := range hits {
+		ids = append(ids, h.id)
+	}
+	return page(ids, limit, offset)
+}
+
+// words 返回 bucket 中所有以 prefix 开头的词, 按字典序排列
+func (idx *index) words(collection, bucket, prefix string) []string {
+	set := make(map[string]struct{})
+	for _, o := range idx.bucket(collection, bucket, false) {
+		for w := range o.words {
+			if strings.HasPrefix(w, prefix) {
+				set[w] = struct{}{}
+			}
+		}
+	}
+	words := make([]string, 0, len(set))
+	for w := range set {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return words
+}
+
+func (idx *index) buckets() int {
+	n := 0
+	for _, buckets := range idx.collections {
+		n += len(buckets)
+	}
+	return n
+}
+
+// clone 深拷贝, 用于 TRIGGER backup/restore
+func (idx *index) clone() *index {
+	c := newIndex()
+	c.seq = idx.seq
+	for collection, buckets := range idx.collections {
+		for bucket, objects := range buckets {
+			dst := c.bucket(collection, bucket, true)
+			for id, o := range objects {
+				words := make(map[string]struct{}, len(o.words))
+				for w := range o.words {
+					words[w] = struct{}{}
+				}
+				dst[id] = &object{seq: o.seq, words: words}
+			}
+		}
+	}
+	return c
+}
+
+func page(items []string, limit, offset int) []string {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
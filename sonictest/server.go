@@ -0,0 +1,427 @@
+// Package sonictest 提供一个内存中的 sonic 服务器, 用于不依赖真实 sonic 的测试
+package sonictest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Version CONNECTED 中返回的版本
+const Version = "sonic-server v1.4.9"
+
+var errDropped = errors.New("sonictest: connection dropped")
+
+// Server 内存中的 sonic 服务器, 支持 search, ingest, control 三个通道
+type Server struct {
+	Password   string // START 时需要的密码
+	BufferSize int    // STARTED 中返回的 buffer 大小, 超过的命令返回 ERR
+
+	addr    string
+	started time.Time
+	done    chan struct{}
+
+	faultsMu sync.Mutex
+	faults   []*Faults
+
+	mu       sync.Mutex
+	index    *index
+	backups  map[string]*index
+	ln       net.Listener
+	conns    map[net.Conn]struct{}
+	accepted int // 已接受的链接数, 用作 session id
+	closed   bool
+
+	clients  int64  // atomic
+	commands uint64 // atomic
+	eventID  uint64 // atomic
+
+	wg sync.WaitGroup
+}
+
+// NewServer 启动一个监听在本地随机端口的服务器, 使用完后需要调用 Close
+func NewServer(password string) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("sonictest: failed to listen on a port: %v", err))
+	}
+
+	s := &Server{
+		Password:   password,
+		BufferSize: 20000,
+		addr:       ln.Addr().String(),
+		ln:         ln,
+		started:    time.Now(),
+		done:       make(chan struct{}),
+		index:      newIndex(),
+		backups:    make(map[string]*index),
+		conns:      make(map[net.Conn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve(ln)
+	return s
+}
+
+// Addr 服务器监听的地址, 形如 127.0.0.1:port
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// DSN 连接该服务器的 DSN
+func (s *Server) DSN() string {
+	return "sonic://:" + s.Password + "@" + s.Addr()
+}
+
+// Close 关闭监听和所有链接, 等待所有协程退出
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.done)
+	if s.ln != nil {
+		_ = s.ln.Close()
+	}
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) serve(ln net.Listener) {
+	defer s.wg.Done()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.accepted++
+		id := s.accepted
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handle(c, id)
+	}
+}
+
+// session 一个客户端链接
+type session struct {
+	s    *Server
+	id   int // 按接受顺序从 1 开始编号
+	c    net.Conn
+	w    *bufio.Writer
+	mode string // START 成功之后才设置
+}
+
+// writeLine 写入一行回复, 会应用注入的故障
+func (ss *session) writeLine(format string, v ...interface{}) error {
+	line := fmt.Sprintf(format, v...) + "\r\n"
+
+	delay, drop, extra := ss.s.takeFaults(ss)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if drop {
+		_, _ = ss.w.WriteString(line[:len(line)/2])
+		_ = ss.w.Flush()
+		_ = ss.c.Close()
+		return errDropped
+	}
+
+	_, err := ss.w.WriteString(line)
+	if err != nil {
+		return err
+	}
+	for _, l := range extra {
+		_, err = ss.w.WriteString(l + "\r\n")
+		if err != nil {
+			return err
+		}
+	}
+	return ss.w.Flush()
+}
+
+func (s *Server) handle(c net.Conn, id int) {
+	atomic.AddInt64(&s.clients, 1)
+	defer func() {
+		atomic.AddInt64(&s.clients, -1)
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		_ = c.Close()
+		s.wg.Done()
+	}()
+
+	ss := &session{s: s, id: id, c: c, w: bufio.NewWriter(c)}
+	if ss.writeLine("CONNECTED <%s>", Version) != nil {
+		return
+	}
+
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+
+		if !ss.dispatch(line) {
+			return
+		}
+	}
+}
+
+// dispatch 处理一行命令, 返回 false 时关闭链接
+func (ss *session) dispatch(line string) bool {
+	atomic.AddUint64(&ss.s.commands, 1)
+
+	if len(line) > ss.s.BufferSize {
+		_ = ss.writeLine("ERR buffer_overflow")
+		return false
+	}
+
+	cmd, ok := parseCommand(line)
+	if !ok {
+		return ss.writeLine("ERR invalid_format(%s)", line) == nil
+	}
+
+	if ss.mode == "" {
+		return ss.start(cmd)
+	}
+
+	switch cmd.name {
+	case "PING":
+		return ss.writeLine("PONG") == nil
+	case "QUIT":
+		_ = ss.writeLine("ENDED quit")
+		return false
+	}
+
+	var err error
+	switch ss.mode {
+	case "search":
+		err = ss.search(cmd)
+	case "ingest":
+		err = ss.ingest(cmd)
+	case "control":
+		err = ss.control(cmd)
+	}
+	return err == nil
+}
+
+// start 处理 START, 和 sonic 一样失败时回复 ENDED <reason> 并断开链接
+func (ss *session) start(cmd *command) bool {
+	if cmd.name != "START" || len(cmd.args) < 1 {
+		_ = ss.writeLine("ENDED not_recognized")
+		return false
+	}
+
+	mode := strings.ToLower(cmd.args[0])
+	switch mode {
+	case "search", "ingest", "control":
+	default:
+		_ = ss.writeLine("ENDED invalid_mode")
+		return false
+	}
+
+	password := ""
+	if len(cmd.args) > 1 {
+		password = cmd.args[1]
+	}
+	if ss.s.Password != "" && password == "" {
+		_ = ss.writeLine("ENDED authentication_required")
+		return false
+	}
+	if ss.s.rejectPasswords(ss) || (ss.s.Password != "" && password != ss.s.Password) {
+		_ = ss.writeLine("ENDED invalid_authentication")
+		return false
+	}
+
+	if ss.writeLine("STARTED %s protocol(1) buffer(%d)", mode, ss.s.BufferSize) != nil {
+		return false
+	}
+	ss.mode = mode
+	return true
+}
+
+func (ss *session) unknown(cmd *command) error {
+	return ss.writeLine("ERR unknown_command")
+}
+
+func (ss *session) invalid(format string) error {
+	return ss.writeLine("ERR invalid_format(%s)", format)
+}
+
+func (ss *session) search(cmd *command) error {
+	s := ss.s
+	var results []string
+
+	switch cmd.name {
+	case "QUERY":
+		if len(cmd.args) != 2 || !cmd.quoted {
+			return ss.invalid(`QUERY <collection> <bucket> "<terms>" [LIMIT(<count>)]? [OFFSET(<count>)]? [LANG(<locale>)]?`)
+		}
+		limit, ok1 := cmd.intParam("LIMIT", 10)
+		offset, ok2 := cmd.intParam("OFFSET", 0)
+		if !ok1 || !ok2 {
+			return ss.invalid("LIMIT(<count>) OFFSET(<count>)")
+		}
+		s.mu.Lock()
+		results = s.index.query(cmd.args[0], cmd.args[1], cmd.text, limit, offset)
+		s.mu.Unlock()
+	case "SUGGEST":
+		if len(cmd.args) != 2 || !cmd.quoted {
+			return ss.invalid(`SUGGEST <collection> <bucket> "<word>" [LIMIT(<count>)]?`)
+		}
+		limit, ok := cmd.intParam("LIMIT", 5)
+		if !ok {
+			return ss.invalid("LIMIT(<count>)")
+		}
+		words := tokenize(cmd.text)
+		if len(words) != 1 {
+			return ss.invalid(`SUGGEST <collection> <bucket> "<word>" [LIMIT(<count>)]?`)
+		}
+		s.mu.Lock()
+		results = page(s.index.words(cmd.args[0], cmd.args[1], words[0]), limit, 0)
+		s.mu.Unlock()
+	case "LIST":
+		if len(cmd.args) != 2 {
+			return ss.invalid("LIST <collection> <bucket> [LIMIT(<count>)]? [OFFSET(<count>)]?")
+		}
+		limit, ok1 := cmd.intParam("LIMIT", 100)
+		offset, ok2 := cmd.intParam("OFFSET", 0)
+		if !ok1 || !ok2 {
+			return ss.invalid("LIMIT(<count>) OFFSET(<count>)")
+		}
+		s.mu.Lock()
+		results = page(s.index.words(cmd.args[0], cmd.args[1], ""), limit, offset)
+		s.mu.Unlock()
+	default:
+		return ss.unknown(cmd)
+	}
+
+	id := strconv.FormatUint(atomic.AddUint64(&s.eventID, 1), 36)
+	if err := ss.writeLine("PENDING %s", id); err != nil {
+		return err
+	}
+
+	line := "EVENT " + cmd.name + " " + id
+	if len(results) > 0 {
+		line += " " + strings.Join(results, " ")
+	}
+	return ss.writeLine("%s", line)
+}
+
+func (ss *session) ingest(cmd *command) error {
+	s := ss.s
+
+	switch cmd.name {
+	case "PUSH":
+		if len(cmd.args) != 3 || !cmd.quoted {
+			return ss.invalid(`PUSH <collection> <bucket> <object> "<text>" [LANG(<locale>)]?`)
+		}
+		s.mu.Lock()
+		s.index.push(cmd.args[0], cmd.args[1], cmd.args[2], cmd.text)
+		s.mu.Unlock()
+		return ss.writeLine("OK")
+	case "POP":
+		if len(cmd.args) != 3 || !cmd.quoted {
+			return ss.invalid(`POP <collection> <bucket> <object> "<text>"`)
+		}
+		return ss.result(func(ix *index) int { return ix.pop(cmd.args[0], cmd.args[1], cmd.args[2], cmd.text) })
+	case "COUNT":
+		if len(cmd.args) < 1 || len(cmd.args) > 3 {
+			return ss.invalid("COUNT <collection> [<bucket> [<object>]?]?")
+		}
+		args := append(cmd.args, "", "")
+		return ss.result(func(ix *index) int { return ix.count(args[0], args[1], args[2]) })
+	case "FLUSHC":
+		if len(cmd.args) != 1 {
+			return ss.invalid("FLUSHC <collection>")
+		}
+		return ss.result(func(ix *index) int { return ix.flushCollection(cmd.args[0]) })
+	case "FLUSHB":
+		if len(cmd.args) != 2 {
+			return ss.invalid("FLUSHB <collection> <bucket>")
+		}
+		return ss.result(func(ix *index) int { return ix.flushBucket(cmd.args[0], cmd.args[1]) })
+	case "FLUSHO":
+		if len(cmd.args) != 3 {
+			return ss.invalid("FLUSHO <collection> <bucket> <object>")
+		}
+		return ss.result(func(ix *index) int { return ix.flushObject(cmd.args[0], cmd.args[1], cmd.args[2]) })
+	}
+	return ss.unknown(cmd)
+}
+
+// result 在锁内访问索引, 释放锁之后再写 RESULT, 注入的延迟不会阻塞其他链接
+func (ss *session) result(fn func(*index) int) error {
+	ss.s.mu.Lock()
+	n := fn(ss.s.index)
+	ss.s.mu.Unlock()
+	return ss.writeLine("RESULT %d", n)
+}
+
+func (ss *session) control(cmd *command) error {
+	s := ss.s
+
+	switch cmd.name {
+	case "TRIGGER":
+		const format = "TRIGGER [consolidate|backup <path>|restore <path>]?"
+		if len(cmd.args) == 0 {
+			return ss.writeLine("OK")
+		}
+		switch {
+		case cmd.args[0] == "consolidate" && len(cmd.args) == 1:
+		case cmd.args[0] == "backup" && len(cmd.args) == 2:
+			s.mu.Lock()
+			s.backups[cmd.args[1]] = s.index.clone()
+			s.mu.Unlock()
+		case cmd.args[0] == "restore" && len(cmd.args) == 2:
+			s.mu.Lock()
+			backup, ok := s.backups[cmd.args[1]]
+			if ok {
+				s.index = backup.clone()
+			}
+			s.mu.Unlock()
+			if !ok {
+				return ss.writeLine("ERR not_found")
+			}
+		default:
+			return ss.invalid(format)
+		}
+		return ss.writeLine("OK")
+	case "INFO":
+		s.mu.Lock()
+		buckets := s.index.buckets()
+		s.mu.Unlock()
+		return ss.writeLine("RESULT uptime(%d) clients_connected(%d) commands_total(%d) command_latency_best(1) command_latency_worst(1) kv_open_count(%d) fst_open_count(%d) fst_consolidate_count(0)",
+			int64(time.Since(s.started)/time.Second),
+			atomic.LoadInt64(&s.clients),
+			atomic.LoadUint64(&s.commands),
+			buckets, buckets)
+	}
+	return ss.unknown(cmd)
+}
@@ -0,0 +1,337 @@
+package sonictest
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rawConn 直接读写协议的测试客户端
+type rawConn struct {
+	t *testing.T
+	c net.Conn
+	r *bufio.Reader
+}
+
+func dialRaw(t *testing.T, s *Server) *rawConn {
+	t.Helper()
+	c, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	rc := &rawConn{t: t, c: c, r: bufio.NewReader(c)}
+	if line := rc.readLine(); line != "CONNECTED <"+Version+">" {
+		t.Fatalf("greeting = %q", line)
+	}
+	return rc
+}
+
+// start 以 mode 通道登录, 返回 STARTED 那一行
+func startRaw(t *testing.T, s *Server, mode string) *rawConn {
+	t.Helper()
+	rc := dialRaw(t, s)
+	if line := rc.send("START " + mode + " " + s.Password); !strings.HasPrefix(line, "STARTED ") {
+		t.Fatalf("START %s = %q", mode, line)
+	}
+	return rc
+}
+
+func (rc *rawConn) readLine() string {
+	rc.t.Helper()
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		rc.t.Fatalf("read: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func (rc *rawConn) send(line string) string {
+	rc.t.Helper()
+	if _, err := rc.c.Write([]byte(line + "\r\n")); err != nil {
+		rc.t.Fatalf("write: %v", err)
+	}
+	return rc.readLine()
+}
+
+func TestStart(t *testing.T) {
+	s := NewServer("secret")
+	defer s.Close()
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"START search secret", "STARTED search protocol(1) buffer(20000)"},
+		{"START ingest secret", "STARTED ingest protocol(1) buffer(20000)"},
+		{"START control secret", "STARTED control protocol(1) buffer(20000)"},
+		{"START search wrong", "ENDED invalid_authentication"},
+		{"START search", "ENDED authentication_required"},
+		{"START other secret", "ENDED invalid_mode"},
+		{"PING", "ENDED not_recognized"},
+	}
+	for _, tt := range tests {
+		rc := dialRaw(t, s)
+		if got := rc.send(tt.line); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSearchEvents(t *testing.T) {
+	s := NewServer("secret")
+	defer s.Close()
+
+	ingest := startRaw(t, s, "ingest")
+	for _, line := range []string{
+		`PUSH c b o1 "hello world"`,
+		`PUSH c b o2 "hello there"`,
+		`PUSH c b o3 "help wanted"`,
+	} {
+		if got := ingest.send(line); got != "OK" {
+			t.Fatalf("%s = %q", line, got)
+		}
+	}
+
+	search := startRaw(t, s, "search")
+	tests := []struct {
+		line  string
+		event string
+		want  []string
+	}{
+		{`QUERY c b "hello"`, "QUERY", []string{"o2", "o1"}},
+		{`QUERY c b "hello" LIMIT(1) OFFSET(1)`, "QUERY", []string{"o1"}},
+		{`QUERY c b "hello world"`, "QUERY", []string{"o1"}},
+		{`QUERY c b "missing"`, "QUERY", nil},
+		{`QUERY c other "hello"`, "QUERY", nil},
+		{`SUGGEST c b "hel"`, "SUGGEST", []string{"hello", "help"}},
+		{`SUGGEST c b "hel" LIMIT(1)`, "SUGGEST", []string{"hello"}},
+		{`LIST c b`, "LIST", []string{"hello", "help", "there", "wanted", "world"}},
+		{`LIST c b LIMIT(2) OFFSET(1)`, "LIST", []string{"help", "there"}},
+	}
+	for _, tt := range tests {
+		pending := search.send(tt.line)
+		fields := strings.Fields(pending)
+		if len(fields) != 2 || fields[0] != "PENDING" {
+			t.Fatalf("%s = %q, want PENDING <id>", tt.line, pending)
+		}
+
+		event := strings.Fields(search.readLine())
+		if len(event) < 3 || event[0] != "EVENT" || event[1] != tt.event || event[2] != fields[1] {
+			t.Fatalf("%s: event = %q, want EVENT %s %s", tt.line, event, tt.event, fields[1])
+		}
+		var got []string
+		if len(event) > 3 {
+			got = event[3:]
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := NewServer("secret")
+	defer s.Close()
+
+	tests := []struct {
+		mode string
+		line string
+		want string
+	}{
+		{"search", `QUERY c b`, "ERR invalid_format("},
+		{"search", `QUERY c b "x" LIMIT(-1)`, "ERR invalid_format("},
+		{"search", `SUGGEST c b "two words"`, "ERR invalid_format("},
+		{"search", `PUSH c b o "x"`, "ERR unknown_command"},
+		{"ingest", `PUSH c b o`, "ERR invalid_format("},
+		{"ingest", `POP c b "x"`, "ERR invalid_format("},
+		{"ingest", `FLUSHB c`, "ERR invalid_format("},
+		{"ingest", `QUERY c b "x"`, "ERR unknown_command"},
+		{"ingest", `PUSH c b o "unterminated`, "ERR invalid_format("},
+		{"control", `TRIGGER restore missing`, "ERR not_found"},
+		{"control", `TRIGGER explode`, "ERR invalid_format("},
+		{"control", `PUSH c b o "x"`, "ERR unknown_command"},
+	}
+	for _, tt := range tests {
+		rc := startRaw(t, s, tt.mode)
+		if got := rc.send(tt.line); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s %s = %q, want prefix %q", tt.mode, tt.line, got, tt.want)
+		}
+		// 普通的 ERR 不会断开链接
+		if got := rc.send("PING"); got != "PONG" {
+			t.Errorf("%s %s: PING after ERR = %q", tt.mode, tt.line, got)
+		}
+	}
+}
+
+func TestBufferOverflow(t *testing.T) {
+	s := NewServer("secret")
+	defer s.Close()
+	s.BufferSize = 64
+
+	rc := startRaw(t, s, "ingest")
+	line := `PUSH c b o "` + strings.Repeat("x", 64) + `"`
+	if got := rc.send(line); got != "ERR buffer_overflow" {
+		t.Fatalf("long line = %q", got)
+	}
+	if _, err := rc.r.ReadString('\n'); err == nil {
+		t.Fatal("connection still open after buffer_overflow")
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	s := NewServer("secret")
+	defer s.Close()
+
+	ingest := startRaw(t, s, "ingest")
+	control := startRaw(t, s, "control")
+
+	steps := []struct {
+		rc   *rawConn
+		line string
+		want string
+	}{
+		{ingest, `PUSH c b o1 "hello"`, "OK"},
+		{control, `TRIGGER backup snap`, "OK"},
+		{ingest, `PUSH c b o2 "hello"`, "OK"},
+		{ingest, `COUNT c b`, "RESULT 2"},
+		{control, `TRIGGER restore snap`, "OK"},
+		{ingest, `COUNT c b`, "RESULT 1"},
+	}
+	for _, st := range steps {
+		if got := st.rc.send(st.line); got != st.want {
+			t.Fatalf("%s = %q, want %q", st.line, got, st.want)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	idx := newIndex()
+	idx.push("c", "b", "o1", "The quick brown fox")
+	idx.push("c", "b", "o2", "quick, QUICK brown dog!")
+	idx.push("c", "b2", "o3", "lazy dog")
+	idx.push("c2", "b", "o4", "fox")
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"count buckets", idx.count("c", "", ""), 2},
+		{"count objects", idx.count("c", "b", ""), 2},
+		{"count words", idx.count("c", "b", "o2"), 3},
+		{"count missing", idx.count("x", "b", "o"), 0},
+		{"query newest first", idx.query("c", "b", "quick", 10, 0), []string{"o2", "o1"}},
+		{"query all terms", idx.query("c", "b", "quick fox", 10, 0), []string{"o1"}},
+		{"query case folded", idx.query("c", "b", "DOG", 10, 0), []string{"o2"}},
+		{"query page", idx.query("c", "b", "brown", 1, 1), []string{"o1"}},
+		{"query past end", idx.query("c", "b", "brown", 10, 5), []string(nil)},
+		{"query no terms", idx.query("c", "b", "!!", 10, 0), []string(nil)},
+		{"words prefix", idx.words("c", "b", "b"), []string{"brown"}},
+		{"words all", idx.words("c", "b2", ""), []string{"dog", "lazy"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if n := idx.pop("c", "b", "o2", "dog cat"); n != 1 {
+		t.Errorf("pop = %d, want 1", n)
+	}
+	if n := idx.pop("c", "b", "o2", "quick brown"); n != 2 {
+		t.Errorf("pop = %d, want 2", n)
+	}
+	if n := idx.count("c", "b", ""); n != 1 {
+		t.Errorf("object with no words left is not removed: count = %d", n)
+	}
+
+	if n := idx.flushObject("c", "b", "o1"); n != 4 {
+		t.Errorf("flushObject = %d, want 4", n)
+	}
+	if n := idx.flushBucket("c", "b2"); n != 1 {
+		t.Errorf("flushBucket = %d, want 1", n)
+	}
+	if n := idx.flushCollection("c2"); n != 1 {
+		t.Errorf("flushCollection = %d, want 1", n)
+	}
+	if n := idx.buckets(); n != 1 {
+		t.Errorf("buckets = %d, want 1", n)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		args   []string
+		text   string
+		params map[string]string
+		ok     bool
+	}{
+		{`query c b "hi" LIMIT(5)`, "QUERY", []string{"c", "b"}, "hi", map[string]string{"LIMIT": "5"}, true},
+		{`PUSH c b o "a \"quoted\" \\ line\nbreak"`, "PUSH", []string{"c", "b", "o"}, "a \"quoted\" \\ line\nbreak", map[string]string{}, true},
+		{`PUSH c b o "x" "y"`, "", nil, "", nil, false},
+		{`PUSH c b o "open`, "", nil, "", nil, false},
+		{`   `, "", nil, "", nil, false},
+	}
+	for _, tt := range tests {
+		cmd, ok := parseCommand(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseCommand(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if cmd.name != tt.name || !reflect.DeepEqual(cmd.args, tt.args) || cmd.text != tt.text || !reflect.DeepEqual(cmd.params, tt.params) {
+			t.Errorf("parseCommand(%q) = %+v", tt.line, cmd)
+		}
+	}
+}
+
+func TestFaultsScope(t *testing.T) {
+	s := NewServer("secret")
+	defer s.Close()
+
+	ingest := startRaw(t, s, "ingest")
+	search := startRaw(t, s, "search")
+
+	// Conns 只影响已经 START 的 ingest 链接, 新链接的握手不受影响
+	s.Conns("ingest").DropMidResponse(1)
+	fresh := startRaw(t, s, "search")
+	if got := search.send("PING"); got != "PONG" {
+		t.Fatalf("search PING = %q, want PONG", got)
+	}
+	if got := fresh.send("PING"); got != "PONG" {
+		t.Fatalf("fresh search PING = %q, want PONG", got)
+	}
+	if _, err := ingest.c.Write([]byte("PING\r\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if line, err := ingest.r.ReadString('\n'); err == nil {
+		t.Fatalf("ingest PING = %q, want a dropped reply", line)
+	}
+
+	// NextConns 只影响调用之后接受的链接
+	s.NextConns(1).RejectPasswords(true)
+	if got := search.send("PING"); got != "PONG" {
+		t.Fatalf("existing PING = %q, want PONG", got)
+	}
+	if got := dialRaw(t, s).send("START search secret"); got != "ENDED invalid_authentication" {
+		t.Fatalf("START on the next conn = %q, want ENDED invalid_authentication", got)
+	}
+	if got := dialRaw(t, s).send("START search secret"); !strings.HasPrefix(got, "STARTED ") {
+		t.Fatalf("START after the next conn = %q, want STARTED", got)
+	}
+
+	s.ResetFaults()
+	if got := startRaw(t, s, "ingest").send("PING"); got != "PONG" {
+		t.Fatalf("PING after ResetFaults = %q, want PONG", got)
+	}
+}